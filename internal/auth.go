@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Authentication methods, as reported on the auth info metric
+const (
+	MethodPublicKey           = "publickey"
+	MethodPassword            = "password"
+	MethodKeyboardInteractive = "keyboard-interactive"
+)
+
+// Build the client configuration. Public keys are offered first, in the order
+// certificate, agent and key file, followed by the password and finally the
+// password as keyboard-interactive response. The method that was tried last is
+// stored in method, which after a successful handshake is the one that
+// succeeded. The returned function releases the agent connection once the
+// handshake is done.
+func (c *Collector) clientConfig(name string, auth AuthConfig, fingerprint string, method *string) (*ssh.ClientConfig, func(), error) {
+	config := &ssh.ClientConfig{
+		User:            auth.Username,
+		HostKeyCallback: c.hostKeyCallback(fingerprint),
+	}
+	done := func() {}
+	var signers []ssh.Signer
+	var methods []string
+
+	var keySigner ssh.Signer
+	if auth.KeyFile != "" {
+		signer, err := readPrivateKey(auth.KeyFile, auth.KeyFilePassphrase)
+		if err != nil {
+			return nil, done, &FetchError{Reason: ReasonAuth, Err: err}
+		}
+		keySigner = signer
+	}
+
+	var agentSigners []ssh.Signer
+	if auth.UseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, done, &FetchError{Reason: ReasonAuth, Err: errors.New("`use_agent` is set but SSH_AUTH_SOCK is not")}
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, done, &FetchError{Reason: ReasonAuth, Err: fmt.Errorf("cannot connect to agent: %w", err)}
+		}
+		done = func() {
+			_ = conn.Close()
+		}
+		if agentSigners, err = agent.NewClient(conn).Signers(); err != nil {
+			done()
+			return nil, func() {}, &FetchError{Reason: ReasonAuth, Err: fmt.Errorf("cannot list agent keys: %w", err)}
+		}
+	}
+
+	if auth.CertFile != "" {
+		signer, err := certSigner(auth.CertFile, append([]ssh.Signer{keySigner}, agentSigners...))
+		if err != nil {
+			done()
+			return nil, func() {}, &FetchError{Reason: ReasonAuth, Err: err}
+		}
+		signers = append(signers, signer)
+		methods = append(methods, "certificate")
+	}
+	if len(agentSigners) > 0 {
+		signers = append(signers, agentSigners...)
+		methods = append(methods, "agent")
+	}
+	if keySigner != nil {
+		signers = append(signers, keySigner)
+		methods = append(methods, "keyfile")
+	}
+	// Public keys are only tried once, so all signers go in a single method
+	if len(signers) > 0 {
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			*method = MethodPublicKey
+			return signers, nil
+		}))
+	}
+	// Use password as authentication option
+	if auth.Password != "" {
+		config.Auth = append(config.Auth, ssh.PasswordCallback(func() (string, error) {
+			*method = MethodPassword
+			return auth.Password, nil
+		}))
+		methods = append(methods, "password")
+		// Some firmware only accepts the password as keyboard-interactive response
+		config.Auth = append(config.Auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			*method = MethodKeyboardInteractive
+			return keyboardInteractiveAnswers(auth, questions, echos), nil
+		}))
+		methods = append(methods, "keyboard-interactive")
+	}
+	log.Debugf("%s: trying authentication methods %s", name, strings.Join(methods, ", "))
+
+	return config, done, nil
+}
+
+func readPrivateKey(path string, passphrase string) (ssh.Signer, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("%s is encrypted, set `keyfile_passphrase`", path)
+	}
+	return signer, err
+}
+
+// Pair an OpenSSH user certificate with the signer that holds its private key
+func certSigner(path string, signers []ssh.Signer) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", path)
+	}
+	for _, signer := range signers {
+		if signer != nil && bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+			return ssh.NewCertSigner(cert, signer)
+		}
+	}
+	return nil, fmt.Errorf("no private key for certificate %s", path)
+}
+
+// Answer hidden prompts with the password, and visible ones with the username
+func keyboardInteractiveAnswers(auth AuthConfig, questions []string, echos []bool) []string {
+	answers := make([]string, len(questions))
+	for i := range questions {
+		if echos[i] {
+			answers[i] = auth.Username
+		} else {
+			answers[i] = auth.Password
+		}
+	}
+	return answers
+}
@@ -1,63 +1,128 @@
 package internal
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"os"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 )
 
 type Collector struct {
-	config Config
+	config      atomic.Pointer[Config]
+	hostKeys    hostKeyStore
+	pool        connectionPool[AccessPointConfig]
+	jumps       connectionPool[string]
+	jumpLocks   keyedMutex
+	mutex       sync.Mutex
+	semaphore   chan struct{}
+	pollContext context.Context
+	pollCancel  context.CancelFunc
+	cache       map[string]AccessPointInfo
+	status      map[string]*AccessPointStatus
+	sources     map[string]Source
+	dumps       map[string][]byte
 }
 
 type APSystemStats struct {
-	CPU float64 `json:"cpu,string"`
-	Mem float64 `json:"mem,string"`
+	CPU FlexFloat `json:"cpu"`
+	Mem FlexFloat `json:"mem"`
 }
 
 type APSysStats struct {
-	LoadAvg1  float64 `json:"loadavg_1,string"`
-	LoadAvg5  float64 `json:"loadavg_5,string"`
-	LoadAvg15 float64 `json:"loadavg_15,string"`
-	MemUsed   int64   `json:"mem_used"`
-	MemTotal  int64   `json:"mem_total"`
-	MemBuffer int64   `json:"mem_buffer"`
+	LoadAvg1  FlexFloat `json:"loadavg_1"`
+	LoadAvg5  FlexFloat `json:"loadavg_5"`
+	LoadAvg15 FlexFloat `json:"loadavg_15"`
+	MemUsed   FlexInt   `json:"mem_used"`
+	MemTotal  FlexInt   `json:"mem_total"`
+	MemBuffer FlexInt   `json:"mem_buffer"`
 }
 
+// An entry of the interface or the port table, the latter names the
+// interface in ifname
 type APInterface struct {
-	TxBytes int64 `json:"tx_bytes"`
-	RxBytes int64 `json:"rx_bytes"`
-	Up      bool  `json:"up"`
+	Name       string  `json:"name"`
+	IfName     string  `json:"ifname"`
+	TxBytes    FlexInt `json:"tx_bytes"`
+	RxBytes    FlexInt `json:"rx_bytes"`
+	TxPackets  FlexInt `json:"tx_packets"`
+	RxPackets  FlexInt `json:"rx_packets"`
+	TxErrors   FlexInt `json:"tx_errors"`
+	RxErrors   FlexInt `json:"rx_errors"`
+	TxDropped  FlexInt `json:"tx_dropped"`
+	RxDropped  FlexInt `json:"rx_dropped"`
+	Speed      FlexInt `json:"speed"`
+	FullDuplex bool    `json:"full_duplex"`
+	Up         bool    `json:"up"`
+}
+
+func (i APInterface) Interface() string {
+	if i.IfName != "" {
+		return i.IfName
+	}
+	return i.Name
+}
+
+type APUplink struct {
+	Name             string  `json:"name"`
+	Type             string  `json:"type"`
+	Speed            FlexInt `json:"speed"`
+	FullDuplex       bool    `json:"full_duplex"`
+	Up               bool    `json:"up"`
+	UplinkMac        string  `json:"uplink_mac"`
+	UplinkDeviceName string  `json:"uplink_device_name"`
+	UplinkRemotePort FlexInt `json:"uplink_remote_port"`
+}
+
+type APNeighbor struct {
+	ChassisID     string `json:"chassis_id"`
+	PortID        string `json:"port_id"`
+	SystemName    string `json:"system_name"`
+	LocalPortName string `json:"local_port_name"`
+	IsWired       bool   `json:"is_wired"`
 }
 
 type APRadio struct {
 	Radio              string   `json:"radio"`
 	RadioName          string   `json:"name"`
-	CurrentAntennaGain int64    `json:"builtin_ant_gain"`
-	MaxTxpower         int64    `json:"max_txpower"`
-	MinTxpower         int64    `json:"min_txpower"`
+	ChannelWidth       FlexInt  `json:"ht"`
+	CurrentAntennaGain FlexInt  `json:"builtin_ant_gain"`
+	MaxTxpower         FlexInt  `json:"max_txpower"`
+	MinTxpower         FlexInt  `json:"min_txpower"`
 	ScanTable          []APScan `json:"scan_table"`
 }
 
+type APRadioStats struct {
+	RadioName      string     `json:"name"`
+	Channel        FlexInt    `json:"channel"`
+	CUTotal        FlexFloat  `json:"cu_total"`
+	CUSelfRx       FlexFloat  `json:"cu_self_rx"`
+	CUSelfTx       FlexFloat  `json:"cu_self_tx"`
+	CUInterference *FlexFloat `json:"cu_interference"`
+}
+
 type APVap struct {
 	Name         string      `json:"name"`
 	Radio        string      `json:"radio"`
 	RadioName    string      `json:"radio_name"`
-	RxBytes      int64       `json:"rx_bytes"`
-	RxDropped    int64       `json:"rx_dropped"`
-	RxErrors     int64       `json:"rx_errors"`
-	TxBytes      int64       `json:"tx_bytes"`
-	TxDropped    int64       `json:"tx_dropped"`
-	TxErrors     int64       `json:"tx_errors"`
-	TxPower      int64       `json:"tx_power"`
-	TxRetries    int64       `json:"tx_retries"`
-	TxSuccess    int64       `json:"tx_success"`
-	TxTotal      int64       `json:"tx_total"`
-	Channel      int64       `json:"channel"`
+	RxBytes      FlexInt     `json:"rx_bytes"`
+	RxDropped    FlexInt     `json:"rx_dropped"`
+	RxErrors     FlexInt     `json:"rx_errors"`
+	TxBytes      FlexInt     `json:"tx_bytes"`
+	TxDropped    FlexInt     `json:"tx_dropped"`
+	TxErrors     FlexInt     `json:"tx_errors"`
+	TxPower      FlexInt     `json:"tx_power"`
+	TxRetries    FlexInt     `json:"tx_retries"`
+	TxSuccess    FlexInt     `json:"tx_success"`
+	TxTotal      FlexInt     `json:"tx_total"`
+	Channel      FlexInt     `json:"channel"`
 	BSSID        string      `json:"bssid"`
 	ESSID        string      `json:"essid"`
 	Usage        string      `json:"usage"`
@@ -65,22 +130,53 @@ type APVap struct {
 }
 
 type APStation struct {
-	Hostname string `json:"hostname"`
-	Mac      string `json:"mac"`
-	TxBytes  int64  `json:"tx_bytes"`
-	RxBytes  int64  `json:"rx_bytes"`
-	Noise    int64  `json:"noise"`
-	Signal   int64  `json:"signal"`
+	Hostname     string  `json:"hostname"`
+	Mac          string  `json:"mac"`
+	IP           string  `json:"ip"`
+	OUI          string  `json:"oui"`
+	IsGuest      bool    `json:"is_guest"`
+	TxBytes      FlexInt `json:"tx_bytes"`
+	RxBytes      FlexInt `json:"rx_bytes"`
+	TxPackets    FlexInt `json:"tx_packets"`
+	RxPackets    FlexInt `json:"rx_packets"`
+	TxRetries    FlexInt `json:"tx_retries"`
+	TxRate       FlexInt `json:"tx_rate"`
+	RxRate       FlexInt `json:"rx_rate"`
+	Noise        FlexInt `json:"noise"`
+	Signal       FlexInt `json:"signal"`
+	RSSI         FlexInt `json:"rssi"`
+	CCQ          FlexInt `json:"ccq"`
+	Uptime       FlexInt `json:"uptime"`
+	IdleTime     FlexInt `json:"idletime"`
+	ChannelWidth FlexInt `json:"chwidth"`
+	Is11n        bool    `json:"is_11n"`
+	Is11ac       bool    `json:"is_11ac"`
+	Is11ax       bool    `json:"is_11ax"`
+	Authorized   bool    `json:"authorized"`
+	PowerSave    bool    `json:"state_pwrmgt"`
+}
+
+// The most recent standard the station uses
+func (s APStation) PhyMode() string {
+	switch {
+	case s.Is11ax:
+		return "ax"
+	case s.Is11ac:
+		return "ac"
+	case s.Is11n:
+		return "n"
+	}
+	return "legacy"
 }
 
 type APScan struct {
-	BSSID     string `json:"bssid"`
-	Channel   int64  `json:"channel"`
-	ESSID     string `json:"essid"`
-	Frequency int64  `json:"freq"`
-	Noise     int64  `json:"noise"`
-	Security  string `json:"security"`
-	Signal    int64  `json:"signal"`
+	BSSID     string  `json:"bssid"`
+	Channel   FlexInt `json:"channel"`
+	ESSID     string  `json:"essid"`
+	Frequency FlexInt `json:"freq"`
+	Noise     FlexInt `json:"noise"`
+	Security  string  `json:"security"`
+	Signal    FlexInt `json:"signal"`
 }
 
 type AccessPointInfo struct {
@@ -89,103 +185,290 @@ type AccessPointInfo struct {
 	Model          string `json:"model"`
 	ModelName      string `json:"model_display"`
 	Name           string
-	Serial         string        `json:"serial"`
-	Version        string        `json:"version"`
-	Uptime         int64         `json:"uptime"`
-	SystemStats    APSystemStats `json:"system-stats"`
-	SysStats       APSysStats    `json:"sys_stats"`
-	InterfaceTable []APInterface `json:"if_table"`
-	RadioTable     []APRadio     `json:"radio_table"`
-	VAPTable       []APVap       `json:"vap_table"`
-	Value          float64
+	Serial         string         `json:"serial"`
+	Version        string         `json:"version"`
+	Uptime         FlexInt        `json:"uptime"`
+	SystemStats    APSystemStats  `json:"system-stats"`
+	SysStats       APSysStats     `json:"sys_stats"`
+	InterfaceTable []APInterface  `json:"if_table"`
+	PortTable      []APInterface  `json:"port_table"`
+	RadioTable     []APRadio      `json:"radio_table"`
+	RadioStats     []APRadioStats `json:"radio_table_stats"`
+	VAPTable       []APVap        `json:"vap_table"`
+	Uplink         *APUplink      `json:"uplink"`
+	LLDPTable      []APNeighbor   `json:"lldp_table"`
+	Up             bool           `json:"-"`
+	Raw            []byte         `json:"-"`
+	AuthMethod     string         `json:"-"`
+	DecodeWarnings []string       `json:"-"`
+	Duration       time.Duration  `json:"-"`
+	Timestamp      time.Time      `json:"-"`
 }
 
 func NewCollector(config Config) *Collector {
 	collector := &Collector{
-		config: config,
+		semaphore: make(chan struct{}, config.Global.Concurrency),
+		pool:      connectionPool[AccessPointConfig]{clients: map[AccessPointConfig]*ssh.Client{}},
+		jumps:     connectionPool[string]{clients: map[string]*ssh.Client{}},
+		cache:     map[string]AccessPointInfo{},
+		status:    map[string]*AccessPointStatus{},
+		sources:   map[string]Source{},
+		dumps:     map[string][]byte{},
+	}
+	for name, newSource := range sources {
+		collector.sources[name] = newSource(collector)
 	}
+	collector.config.Store(&config)
+	warnInsecure(config)
+	logRecording(config)
 	return collector
 }
 
-func (c *Collector) Collect() (*[]AccessPointInfo, error) {
-	var accessPointInfos = []AccessPointInfo{}
+func (c *Collector) Config() *Config {
+	return c.config.Load()
+}
 
-	for _, accessPoint := range c.config.AccessPoints {
-		accessPointInfo, err := c.Fetch(accessPoint)
-		if err != nil {
-			accessPointInfos = append(accessPointInfos, AccessPointInfo{
-				Name:  accessPoint.Name,
-				IP:    accessPoint.Address,
-				Value: 0,
-			})
-			log.Errorf("%s: %s", accessPoint.Address, err)
-			continue
+func warnInsecure(config Config) {
+	if config.Global.KnownHosts != "" {
+		return
+	}
+	for _, accessPoint := range config.AccessPoints {
+		if accessPoint.Source == SourceSSH && accessPoint.Fingerprint == "" {
+			log.Warnf("%s: host key will not be verified, set `fingerprint` or `known_hosts`", accessPoint.Name)
+		}
+	}
+	for name, jumpHost := range config.JumpHosts {
+		if jumpHost.Fingerprint == "" {
+			log.Warnf("%s: host key will not be verified, set `fingerprint` or `known_hosts`", name)
 		}
+	}
+}
 
-		accessPointInfos = append(accessPointInfos, *accessPointInfo)
+func (c *Collector) Collect(ctx context.Context) (*[]AccessPointInfo, error) {
+	accessPoints := c.Config().AccessPoints
+	var accessPointInfos = make([]AccessPointInfo, len(accessPoints))
+
+	// Fetch in parallel, but keep the results in configuration order
+	var wg sync.WaitGroup
+	for i, accessPoint := range accessPoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accessPointInfos[i] = c.fetch(ctx, accessPoint)
+		}()
 	}
+	wg.Wait()
 
 	return &accessPointInfos, nil
 }
 
-func (c *Collector) Fetch(accessPoint AccessPointConfig) (*AccessPointInfo, error) {
-	config := &ssh.ClientConfig{
-		User:            accessPoint.Username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	// Use password as authentication option
-	if accessPoint.Password != "" {
-		config.Auth = append(config.Auth, ssh.Password(accessPoint.Password))
-	}
-	// Use key as authentication option
-	if accessPoint.KeyFile != "" {
-		key, err := os.ReadFile(accessPoint.KeyFile)
-		if err != nil {
-			return nil, err
+// Fetch within the concurrency limit, turning errors into a down access point
+func (c *Collector) fetch(ctx context.Context, accessPoint AccessPointConfig) AccessPointInfo {
+	if c.circuitOpen(accessPoint.Name) {
+		log.Debugf("%s: circuit open, skipping", accessPoint.Name)
+		return AccessPointInfo{
+			Name:      accessPoint.Name,
+			IP:        accessPoint.Address,
+			Timestamp: time.Now(),
 		}
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, err
+	}
+
+	accessPointInfo, err := c.fetchInfo(ctx, accessPoint)
+	c.record(accessPointInfo, err)
+	c.saveDump(accessPoint, accessPointInfo)
+
+	return accessPointInfo
+}
+
+// Fetch an access point that is not part of the configuration. Its status is
+// returned instead of being kept, so probing arbitrary targets does not grow
+// the collector, and it neither trips nor honours a circuit breaker.
+func (c *Collector) probe(ctx context.Context, accessPoint AccessPointConfig) (AccessPointInfo, AccessPointStatus) {
+	accessPointInfo, err := c.fetchInfo(ctx, accessPoint)
+	status := newAccessPointStatus(accessPoint.Name)
+	status.update(accessPointInfo, err)
+
+	return accessPointInfo, *status
+}
+
+func (c *Collector) fetchInfo(ctx context.Context, accessPoint AccessPointConfig) (AccessPointInfo, error) {
+	start := time.Now()
+	accessPointInfo, err := c.fetchWithRetries(ctx, accessPoint)
+	if err != nil {
+		log.Errorf("%s: %s", accessPoint.Name, err)
+		accessPointInfo = &AccessPointInfo{
+			Name:      accessPoint.Name,
+			IP:        accessPoint.Address,
+			Timestamp: time.Now(),
 		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
 	}
+	accessPointInfo.Duration = time.Since(start)
+
+	return *accessPointInfo, err
+}
+
+// Fetch once within the concurrency limit
+func (c *Collector) attempt(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error) {
+	c.mutex.Lock()
+	semaphore := c.semaphore
+	c.mutex.Unlock()
+	select {
+	case semaphore <- struct{}{}:
+		defer func() {
+			<-semaphore
+		}()
+		return c.Fetch(ctx, accessPoint)
+	case <-ctx.Done():
+		return nil, &FetchError{Reason: ReasonDial, Err: ctx.Err()}
+	}
+}
 
-	client, err := ssh.Dial("tcp", fmt.Sprint(accessPoint.Address, ":22"), config)
+// Get a pooled connection if possible, or dial a new one. Returns whether the
+// connection is kept in the pool, and whether it was taken from the pool. The
+// authentication method is set when a new connection is dialed.
+func (c *Collector) connect(ctx context.Context, accessPoint AccessPointConfig, method *string) (*ssh.Client, bool, bool, error) {
+	global := c.Config().Global
+	if !global.PersistentConnections {
+		client, err := c.dial(ctx, accessPoint, method)
+		return client, false, false, err
+	}
+	if client := c.pool.get(accessPoint); client != nil {
+		return client, true, true, nil
+	}
+	client, err := c.dial(ctx, accessPoint, method)
 	if err != nil {
-		return nil, err
+		return nil, false, false, err
 	}
-	defer func() {
-		_ = client.Close()
-	}()
+	pooled := c.pool.put(accessPoint, accessPoint.Address, client, global.Keepalive)
+	return client, pooled, false, nil
+}
 
-	session, err := client.NewSession()
+func (c *Collector) dial(ctx context.Context, accessPoint AccessPointConfig, method *string) (*ssh.Client, error) {
+	var authMethod string
+	config, done, err := c.clientConfig(accessPoint.Address, accessPoint.AuthConfig, accessPoint.Fingerprint, &authMethod)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = session.Close()
-	}()
+	defer done()
 
-	stdout, err := session.StdoutPipe()
+	address := joinHostPort(accessPoint.Address, accessPoint.Port)
+	conn, err := c.dialContext(ctx, accessPoint.ProxyJump, address)
 	if err != nil {
 		return nil, err
 	}
-	// "mca" stands for "Management Control Agent"
-	if err := session.Run("mca-dump"); err != nil {
+	client, err := handshake(ctx, conn, address, config)
+	if err != nil {
 		return nil, err
 	}
-	output, err := io.ReadAll(stdout)
+	log.Debugf("%s: authenticated using %s", accessPoint.Name, authMethod)
+	*method = authMethod
+	return client, nil
+}
+
+func joinHostPort(host string, port int) string {
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
+func handshake(ctx context.Context, conn net.Conn, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	// Closing the connection aborts a hanging handshake
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	// Anything failing after the host key is accepted fails authentication
+	var accepted atomic.Bool
+	tracked := *config
+	tracked.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := config.HostKeyCallback(hostname, remote, key)
+		accepted.Store(err == nil)
+		return err
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, address, &tracked)
 	if err != nil {
-		return nil, err
+		_ = conn.Close()
+		var mismatch *HostKeyMismatchError
+		var unknown *UnknownHostKeyError
+		switch {
+		case errors.As(err, &mismatch) || errors.As(err, &unknown):
+			return nil, &FetchError{Reason: ReasonHostKey, Err: err}
+		case ctx.Err() != nil || !accepted.Load():
+			return nil, &FetchError{Reason: ReasonDial, Err: contextError(ctx, err)}
+		}
+		return nil, &FetchError{Reason: ReasonAuth, Err: err}
 	}
+	return ssh.NewClient(sshConn, channels, requests), nil
+}
+
+// Run mca-dump in a new session, dropping the connection when anything fails
+func (c *Collector) run(ctx context.Context, accessPoint AccessPointConfig, client *ssh.Client, pooled bool) ([]byte, error) {
+	// Closing the connection aborts a hanging command
+	stop := context.AfterFunc(ctx, func() {
+		c.pool.discard(accessPoint, client)
+	})
+	defer stop()
+
+	output, err := func() ([]byte, error) {
+		session, err := client.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = session.Close()
+		}()
 
-	accessPointInfo := &AccessPointInfo{
-		Name:  accessPoint.Name,
-		Value: 1,
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		// "mca" stands for "Management Control Agent"
+		if err := session.Run("mca-dump"); err != nil {
+			return nil, contextError(ctx, err)
+		}
+		output, err := io.ReadAll(stdout)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		return output, nil
+	}()
+	if err != nil || !pooled {
+		c.pool.discard(accessPoint, client)
 	}
-	if err = json.Unmarshal(output, &accessPointInfo); err != nil {
-		return nil, err
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonCommand, Err: err}
 	}
 
-	return accessPointInfo, err
+	return output, nil
+}
+
+// Prefer the context error over the error caused by closing the connection
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Describe the switch port of the uplink, preferring what the switch announces
+// over LLDP
+func (a AccessPointInfo) UplinkSwitch() (string, string, string) {
+	var switchName, port, chassisID string
+	if a.Uplink != nil {
+		switchName, chassisID = a.Uplink.UplinkDeviceName, a.Uplink.UplinkMac
+		if a.Uplink.UplinkRemotePort > 0 {
+			port = strconv.FormatInt(int64(a.Uplink.UplinkRemotePort), 10)
+		}
+	}
+	for _, neighbor := range a.LLDPTable {
+		if !neighbor.IsWired || (a.Uplink != nil && neighbor.LocalPortName != a.Uplink.Name) {
+			continue
+		}
+		if neighbor.SystemName != "" {
+			switchName = neighbor.SystemName
+		}
+		port, chassisID = neighbor.PortID, neighbor.ChassisID
+		break
+	}
+	return switchName, port, chassisID
 }
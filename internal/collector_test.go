@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Accept connections on a random port and hand them to the function
+func startListener(t *testing.T, handle func(conn net.Conn)) (string, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port
+}
+
+func TestHandshakeReasons(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type target struct {
+		address     string
+		port        int
+		fingerprint string
+	}
+	targets := map[string]target{}
+	address, port, fingerprint := startSimulator(t, SimulatorConfig{})
+	targets["unknown"] = target{address, port, ""}
+	targets["mismatch"] = target{address, port, "SHA256:mismatch"}
+	targets["good"] = target{address, port, fingerprint}
+	address, port, fingerprint = startSimulator(t, SimulatorConfig{FailAuth: true})
+	targets["auth"] = target{address, port, fingerprint}
+	address, port = startListener(t, func(conn net.Conn) {
+		_ = conn.Close()
+	})
+	targets["reset"] = target{address, port, "SHA256:reset"}
+	address, port = startListener(t, func(conn net.Conn) {
+		// Never answer, until the client gives up
+		_, _ = io.Copy(io.Discard, conn)
+		_ = conn.Close()
+	})
+	targets["hanging"] = target{address, port, "SHA256:hanging"}
+
+	yaml := "global:\n  known_hosts: " + knownHosts + "\ndefaults:\n  username: admin\n  password: secret\naccesspoints:\n"
+	for name, target := range targets {
+		yaml += fmt.Sprintf("  - name: %s\n    address: %s\n    port: %d\n", name, target.address, target.port)
+		if target.fingerprint != "" {
+			yaml += "    fingerprint: " + target.fingerprint + "\n"
+		}
+	}
+	config := mustLoadConfig(t, yaml)
+	collector := NewCollector(*config)
+
+	reasons := map[string]string{
+		"good":     "",
+		"unknown":  ReasonHostKey,
+		"mismatch": ReasonHostKey,
+		"auth":     ReasonAuth,
+		"reset":    ReasonDial,
+		"hanging":  ReasonDial,
+	}
+	for _, accessPoint := range config.AccessPoints {
+		t.Run(accessPoint.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			var method string
+			client, err := collector.dial(ctx, accessPoint, &method)
+			if reasons[accessPoint.Name] == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = client.Close()
+				if method != "password" {
+					t.Errorf("got method %q, want password", method)
+				}
+				return
+			}
+			var fetchError *FetchError
+			if !errors.As(err, &fetchError) || fetchError.Reason != reasons[accessPoint.Name] {
+				t.Errorf("got error %v, want reason %s", err, reasons[accessPoint.Name])
+			}
+		})
+	}
+}
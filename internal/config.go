@@ -1,34 +1,113 @@
 package internal
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type GlobalConfig struct {
-	ListenPort int `yaml:"port"`
+	ListenPort              int           `yaml:"port"`
+	ListenAddresses         stringList    `yaml:"listen_address"`
+	Concurrency             int           `yaml:"concurrency"`
+	Timeout                 time.Duration `yaml:"timeout"`
+	Retries                 int           `yaml:"retries"`
+	RetryBackoff            time.Duration `yaml:"retry_backoff"`
+	CircuitBreakerThreshold int           `yaml:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown  time.Duration `yaml:"circuit_breaker_cooldown"`
+	PollInterval            time.Duration `yaml:"poll_interval"`
+	MaxAge                  time.Duration `yaml:"max_age"`
+	PersistentConnections   bool          `yaml:"persistent_connections"`
+	Keepalive               time.Duration `yaml:"keepalive"`
+	KnownHosts              string        `yaml:"known_hosts"`
+	TrustOnFirstUse         bool          `yaml:"trust_on_first_use"`
+	ReloadEndpoint          bool          `yaml:"reload_endpoint"`
+	DumpEndpoint            bool          `yaml:"dump_endpoint"`
+	ProxyJump               string        `yaml:"proxy_jump"`
+	RecordDir               string        `yaml:"record_dir"`
+	RecordLimit             int           `yaml:"record_limit"`
+}
+
+type AuthConfig struct {
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	PasswordFile          string `yaml:"password_file"`
+	PasswordEnv           string `yaml:"password_env"`
+	PasswordCommand       string `yaml:"password_command"`
+	KeyFile               string `yaml:"keyfile"`
+	KeyFilePassphrase     string `yaml:"keyfile_passphrase"`
+	KeyFilePassphraseFile string `yaml:"keyfile_passphrase_file"`
+	KeyFilePassphraseEnv  string `yaml:"keyfile_passphrase_env"`
+	CertFile              string `yaml:"certfile"`
+	UseAgent              bool   `yaml:"use_agent"`
 }
 
 type AccessPointConfig struct {
-	Name     string `yaml:"name"`
-	Address  string `yaml:"address"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	KeyFile  string `yaml:"keyfile"`
+	Name         string `yaml:"name"`
+	Source       string `yaml:"source"`
+	Path         string `yaml:"path"`
+	Address      string `yaml:"address"`
+	Port         int    `yaml:"port"`
+	AuthProfile  string `yaml:"auth_profile"`
+	AuthConfig   `yaml:",inline"`
+	Fingerprint  string        `yaml:"fingerprint"`
+	ProxyJump    string        `yaml:"proxy_jump"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Record       bool          `yaml:"record"`
+}
+
+type JumpHostConfig struct {
+	Address     string `yaml:"address"`
+	Port        int    `yaml:"port"`
+	AuthConfig  `yaml:",inline"`
+	Fingerprint string `yaml:"fingerprint"`
 }
 
 type Config struct {
-	Global       GlobalConfig        `yaml:"global"`
-	AccessPoints []AccessPointConfig `yaml:"accesspoints"`
+	Global       GlobalConfig              `yaml:"global"`
+	Defaults     AccessPointConfig         `yaml:"defaults"`
+	AuthProfiles map[string]AuthConfig     `yaml:"auth_profiles"`
+	JumpHosts    map[string]JumpHostConfig `yaml:"jump_hosts"`
+	AccessPoints []AccessPointConfig       `yaml:"accesspoints"`
+	path         string
+}
+
+const defaultSSHPort = 22
+
+// A list that can also be written as a single value
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
 }
 
 func NewConfig(path string) (*Config, error) {
 	config := &Config{
 		Global: GlobalConfig{
-			ListenPort: 9130,
+			ListenPort:             9130,
+			Concurrency:            8,
+			Timeout:                10 * time.Second,
+			RetryBackoff:           time.Second,
+			CircuitBreakerCooldown: 5 * time.Minute,
+			Keepalive:              30 * time.Second,
+			RecordLimit:            10,
 		},
 	}
 
@@ -40,7 +119,19 @@ func NewConfig(path string) (*Config, error) {
 		_ = file.Close()
 	}()
 
-	data := yaml.NewDecoder(file)
+	var node yaml.Node
+	if err := yaml.NewDecoder(file).Decode(&node); err != nil {
+		return nil, err
+	}
+	if err := expandEnvironment(&node); err != nil {
+		return nil, err
+	}
+	expanded, err := yaml.Marshal(&node)
+	if err != nil {
+		return nil, err
+	}
+
+	data := yaml.NewDecoder(bytes.NewReader(expanded))
 	data.KnownFields(true)
 	if err := data.Decode(&config); err != nil {
 		return nil, err
@@ -50,25 +141,270 @@ func NewConfig(path string) (*Config, error) {
 		return nil, errors.New("config is empty")
 	}
 
-	if len(config.AccessPoints) == 0 {
-		return nil, errors.New("no access points defined")
+	config.path = path
+
+	if len(config.Global.ListenAddresses) == 0 {
+		config.Global.ListenAddresses = stringList{fmt.Sprint(":", config.Global.ListenPort)}
+	}
+	for _, listenAddress := range config.Global.ListenAddresses {
+		if _, _, err := net.SplitHostPort(listenAddress); err != nil {
+			return nil, fmt.Errorf("invalid `listen_address`: %w", err)
+		}
+	}
+
+	if config.Global.Concurrency < 1 {
+		return nil, errors.New("`concurrency` must be at least 1")
+	}
+
+	if config.Global.Timeout <= 0 {
+		return nil, errors.New("`timeout` must be positive")
+	}
+
+	if config.Global.Retries < 0 || config.Global.CircuitBreakerThreshold < 0 {
+		return nil, errors.New("`retries` and `circuit_breaker_threshold` cannot be negative")
+	}
+
+	if config.Global.Retries > 0 && config.Global.RetryBackoff <= 0 {
+		return nil, errors.New("`retry_backoff` must be positive")
+	}
+
+	if config.Global.CircuitBreakerThreshold > 0 && config.Global.CircuitBreakerCooldown <= 0 {
+		return nil, errors.New("`circuit_breaker_cooldown` must be positive")
+	}
+
+	if config.Global.PollInterval < 0 || config.Global.MaxAge < 0 {
+		return nil, errors.New("`poll_interval` and `max_age` cannot be negative")
+	}
+
+	if config.Global.Keepalive <= 0 {
+		return nil, errors.New("`keepalive` must be positive")
+	}
+
+	if config.Global.RecordLimit < 1 {
+		return nil, errors.New("`record_limit` must be at least 1")
+	}
+
+	if config.Global.TrustOnFirstUse && config.Global.KnownHosts == "" {
+		return nil, errors.New("`trust_on_first_use` requires `known_hosts`")
+	}
+
+	if len(config.AccessPoints) == 0 && len(config.AuthProfiles) == 0 && config.Defaults.Username == "" {
+		return nil, errors.New("no access points, auth profiles or defaults defined")
+	}
+
+	if config.Defaults.Name != "" || config.Defaults.Path != "" || config.Defaults.Address != "" {
+		return nil, errors.New("`defaults` cannot set `name`, `path` or `address`")
+	}
+	if err := config.Defaults.resolve(); err != nil {
+		return nil, fmt.Errorf("defaults %w", err)
+	}
+	for name, authProfile := range config.AuthProfiles {
+		if err := authProfile.resolve(); err != nil {
+			return nil, fmt.Errorf("auth profile `%s` %w", name, err)
+		}
+		config.AuthProfiles[name] = authProfile
+	}
+
+	for name, jumpHost := range config.JumpHosts {
+		if jumpHost.Address == "" {
+			return nil, fmt.Errorf("jump host `%s` is missing `address`", name)
+		}
+		if jumpHost.Port == 0 {
+			jumpHost.Port = defaultSSHPort
+		}
+		if err := jumpHost.resolve(); err != nil {
+			return nil, fmt.Errorf("jump host `%s` %w", name, err)
+		}
+		if err := jumpHost.validate(); err != nil {
+			return nil, fmt.Errorf("jump host `%s` %w", name, err)
+		}
+		config.JumpHosts[name] = jumpHost
 	}
 
 	/* Check configuration */
-	for i, accessPoint := range config.AccessPoints {
+	for i := range config.AccessPoints {
+		accessPoint := &config.AccessPoints[i]
 		if accessPoint.Name == "" {
 			return nil, fmt.Errorf("accesspoint #%d is missing `name`", i+1)
 		}
-		if accessPoint.Address == "" {
-			return nil, fmt.Errorf("accesspoint #%d is missing `address`", i+1)
+		if err := accessPoint.resolve(); err != nil {
+			return nil, fmt.Errorf("accesspoint #%d %w", i+1, err)
+		}
+		if err := config.complete(accessPoint); err != nil {
+			return nil, fmt.Errorf("accesspoint #%d %w", i+1, err)
 		}
-		if accessPoint.Username == "" {
-			return nil, fmt.Errorf("accesspoint #%d is missing `username`", i+1)
+		if accessPoint.PollInterval < 0 {
+			return nil, fmt.Errorf("accesspoint #%d has a negative `poll_interval`", i+1)
 		}
-		if accessPoint.Password == "" && accessPoint.KeyFile == "" {
-			return nil, fmt.Errorf("accesspoint #%d requires either `password` or `keyfile`", i+1)
+		if accessPoint.PollInterval > 0 && config.Global.PollInterval == 0 {
+			return nil, fmt.Errorf("accesspoint #%d sets `poll_interval` but background polling is disabled", i+1)
 		}
 	}
 
 	return config, nil
 }
+
+// Fill in the access point from its auth profile and the defaults, then check
+// that it is usable
+func (c *Config) complete(accessPoint *AccessPointConfig) error {
+	// The auth profile takes precedence over the defaults
+	if accessPoint.AuthProfile == "" {
+		accessPoint.AuthProfile = c.Defaults.AuthProfile
+	}
+	if accessPoint.AuthProfile != "" {
+		authProfile, ok := c.AuthProfiles[accessPoint.AuthProfile]
+		if !ok {
+			return fmt.Errorf("refers to unknown auth profile `%s`", accessPoint.AuthProfile)
+		}
+		accessPoint.AuthConfig.inherit(authProfile)
+	}
+	accessPoint.inherit(c.Defaults)
+	if accessPoint.Source == "" {
+		accessPoint.Source = SourceSSH
+	}
+	if _, ok := sources[accessPoint.Source]; !ok {
+		return fmt.Errorf("has an unknown `source` %s", accessPoint.Source)
+	}
+	if accessPoint.Source == SourceFile {
+		if accessPoint.Path == "" {
+			return errors.New("is missing `path`")
+		}
+		if _, err := filepath.Match(accessPoint.Path, ""); err != nil {
+			return fmt.Errorf("has an invalid `path`: %w", err)
+		}
+		return nil
+	}
+	// Everything else only applies to SSH
+	if accessPoint.Source != SourceSSH {
+		return nil
+	}
+	if accessPoint.Address == "" {
+		return errors.New("is missing `address`")
+	}
+	if accessPoint.Port == 0 {
+		accessPoint.Port = defaultSSHPort
+	}
+	if accessPoint.Port < 1 || accessPoint.Port > 65535 {
+		return fmt.Errorf("has an invalid `port` %d", accessPoint.Port)
+	}
+	if accessPoint.ProxyJump == "" {
+		accessPoint.ProxyJump = c.Global.ProxyJump
+	}
+	if accessPoint.ProxyJump == "none" {
+		accessPoint.ProxyJump = ""
+	}
+	if accessPoint.ProxyJump != "" {
+		names := strings.Split(accessPoint.ProxyJump, ",")
+		for i, name := range names {
+			names[i] = strings.TrimSpace(name)
+			if _, ok := c.JumpHosts[names[i]]; !ok {
+				return fmt.Errorf("refers to unknown jump host `%s`", names[i])
+			}
+		}
+		accessPoint.ProxyJump = strings.Join(names, ",")
+	}
+	return accessPoint.validate()
+}
+
+// Build the configuration of an access point that is only known by address,
+// optionally with a port
+func (c *Config) probeAccessPoint(target string, authProfile string) (AccessPointConfig, error) {
+	accessPoint := AccessPointConfig{
+		Name:        target,
+		Source:      SourceSSH,
+		Address:     target,
+		AuthProfile: authProfile,
+	}
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		accessPoint.Address = host
+		if accessPoint.Port, err = strconv.Atoi(port); err != nil {
+			return accessPoint, fmt.Errorf("target has an invalid port: %w", err)
+		}
+	}
+	if err := c.complete(&accessPoint); err != nil {
+		return accessPoint, fmt.Errorf("target %w", err)
+	}
+
+	// Anyone can pick the target, so credentials are only sent to hosts whose
+	// key is known beforehand
+	if !c.verifiesHostKey(accessPoint.Fingerprint) {
+		return accessPoint, errUnverifiedProbe
+	}
+	if accessPoint.ProxyJump != "" {
+		for _, name := range strings.Split(accessPoint.ProxyJump, ",") {
+			if !c.verifiesHostKey(c.JumpHosts[name].Fingerprint) {
+				return accessPoint, errUnverifiedProbe
+			}
+		}
+	}
+	return accessPoint, nil
+}
+
+var errUnverifiedProbe = errors.New("probing requires verified host keys, set `known_hosts` without `trust_on_first_use`, or a `fingerprint`")
+
+// Whether host keys are checked against a pinned fingerprint or known_hosts,
+// without trusting unknown hosts
+func (c *Config) verifiesHostKey(fingerprint string) bool {
+	return fingerprint != "" || c.Global.KnownHosts != "" && !c.Global.TrustOnFirstUse
+}
+
+// Take any settings that are not set from another configuration
+func (a *AccessPointConfig) inherit(from AccessPointConfig) {
+	if a.Source == "" {
+		a.Source = from.Source
+	}
+	if a.AuthProfile == "" {
+		a.AuthProfile = from.AuthProfile
+	}
+	a.AuthConfig.inherit(from.AuthConfig)
+	if a.Port == 0 {
+		a.Port = from.Port
+	}
+	if a.Fingerprint == "" {
+		a.Fingerprint = from.Fingerprint
+	}
+	if a.ProxyJump == "" {
+		a.ProxyJump = from.ProxyJump
+	}
+	if a.PollInterval == 0 {
+		a.PollInterval = from.PollInterval
+	}
+	if !a.Record {
+		a.Record = from.Record
+	}
+}
+
+func (a *AuthConfig) inherit(from AuthConfig) {
+	if a.Username == "" {
+		a.Username = from.Username
+	}
+	// Passwords are resolved before inheriting, so only the password remains
+	if a.Password == "" && a.PasswordFile == "" && a.PasswordEnv == "" && a.PasswordCommand == "" {
+		a.Password = from.Password
+	}
+	// The certificate and passphrase belong with the key file
+	if a.KeyFile == "" && a.CertFile == "" {
+		a.KeyFile = from.KeyFile
+		a.KeyFilePassphrase = from.KeyFilePassphrase
+		a.CertFile = from.CertFile
+	}
+	if !a.UseAgent {
+		a.UseAgent = from.UseAgent
+	}
+}
+
+func (a AuthConfig) validate() error {
+	if a.Username == "" {
+		return errors.New("is missing `username`")
+	}
+	if a.Password == "" && a.KeyFile == "" && !a.UseAgent {
+		return errors.New("requires a password, `keyfile` or `use_agent`")
+	}
+	if a.CertFile != "" && a.KeyFile == "" && !a.UseAgent {
+		return errors.New("requires `keyfile` or `use_agent` for `certfile`")
+	}
+	if a.KeyFilePassphrase != "" && a.KeyFile == "" {
+		return errors.New("has a key file passphrase but no `keyfile`")
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Load a configuration from YAML, failing the test if it is invalid
+func mustLoadConfig(t *testing.T, yaml string) *Config {
+	t.Helper()
+	config, err := loadConfig(t, yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func loadConfig(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return NewConfig(path)
+}
+
+func TestConfigSecrets(t *testing.T) {
+	t.Setenv("UNIFI_AP_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "resolved everywhere",
+			yaml: `
+defaults:
+  username: admin
+  password_env: UNIFI_AP_TEST_SECRET
+auth_profiles:
+  profile:
+    username: profile
+    password_command: echo from-env
+jump_hosts:
+  bastion:
+    address: 192.0.2.1
+    username: jump
+    password_env: UNIFI_AP_TEST_SECRET
+accesspoints:
+  - name: ap
+    address: 192.0.2.10
+    auth_profile: profile
+`,
+		},
+		{
+			name: "two sources in defaults",
+			yaml: `
+defaults:
+  username: admin
+  password: secret
+  password_env: UNIFI_AP_TEST_SECRET
+`,
+			err: "defaults accepts only one of",
+		},
+		{
+			name: "two sources in auth profile",
+			yaml: `
+auth_profiles:
+  profile:
+    username: admin
+    password: secret
+    password_command: echo secret
+`,
+			err: "auth profile `profile` accepts only one of",
+		},
+		{
+			name: "whitespace command in access point",
+			yaml: `
+accesspoints:
+  - name: ap
+    address: 192.0.2.10
+    username: admin
+    password_command: "  "
+`,
+			err: "accesspoint #1 cannot read password: command is empty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadConfig(t, test.yaml)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Defaults.Password != "from-env" || config.AuthProfiles["profile"].Password != "from-env" ||
+				config.JumpHosts["bastion"].Password != "from-env" || config.AccessPoints[0].Password != "from-env" {
+				t.Errorf("secrets are not resolved: %+v", config)
+			}
+		})
+	}
+}
+
+func TestAuthConfigInherit(t *testing.T) {
+	from := AuthConfig{
+		Username:          "from",
+		Password:          "from-password",
+		KeyFile:           "from-key",
+		KeyFilePassphrase: "from-passphrase",
+		CertFile:          "from-cert",
+		UseAgent:          true,
+	}
+	tests := []struct {
+		name string
+		auth AuthConfig
+		want AuthConfig
+	}{
+		{
+			name: "everything inherited",
+			auth: AuthConfig{},
+			want: from,
+		},
+		{
+			name: "own username and password",
+			auth: AuthConfig{Username: "own", Password: "own-password"},
+			want: AuthConfig{Username: "own", Password: "own-password", KeyFile: "from-key",
+				KeyFilePassphrase: "from-passphrase", CertFile: "from-cert", UseAgent: true},
+		},
+		{
+			name: "own key file without passphrase",
+			auth: AuthConfig{KeyFile: "own-key"},
+			want: AuthConfig{Username: "from", Password: "from-password", KeyFile: "own-key", UseAgent: true},
+		},
+		{
+			name: "own certificate for an agent key",
+			auth: AuthConfig{CertFile: "own-cert"},
+			want: AuthConfig{Username: "from", Password: "from-password", CertFile: "own-cert", UseAgent: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := test.auth
+			auth.inherit(from)
+			if auth != test.want {
+				t.Errorf("got %+v, want %+v", auth, test.want)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	const header = `
+global:
+  record_dir: /tmp
+jump_hosts:
+  bastion:
+    address: 192.0.2.1
+    username: jump
+    password: jump
+defaults:
+  username: defaults
+  password: defaults
+  keyfile: defaults-key
+  keyfile_passphrase: defaults-passphrase
+  port: 2200
+  fingerprint: SHA256:defaults
+auth_profiles:
+  profile:
+    username: profile
+    password: profile
+    keyfile: profile-key
+accesspoints:
+`
+	tests := []struct {
+		name  string
+		yaml  string
+		check func(t *testing.T, accessPoint AccessPointConfig)
+		err   string
+	}{
+		{
+			name: "defaults",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+`,
+			check: func(t *testing.T, accessPoint AccessPointConfig) {
+				if accessPoint.Username != "defaults" || accessPoint.Password != "defaults" ||
+					accessPoint.KeyFile != "defaults-key" || accessPoint.KeyFilePassphrase != "defaults-passphrase" ||
+					accessPoint.Port != 2200 || accessPoint.Fingerprint != "SHA256:defaults" || accessPoint.Source != SourceSSH {
+					t.Errorf("defaults not applied: %+v", accessPoint)
+				}
+			},
+		},
+		{
+			name: "auth profile before defaults",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    auth_profile: profile
+`,
+			check: func(t *testing.T, accessPoint AccessPointConfig) {
+				if accessPoint.Username != "profile" || accessPoint.Password != "profile" ||
+					accessPoint.KeyFile != "profile-key" || accessPoint.Port != 2200 {
+					t.Errorf("auth profile not applied: %+v", accessPoint)
+				}
+				if accessPoint.KeyFilePassphrase != "" {
+					t.Errorf("passphrase of the defaults key file used for the profile key file: %+v", accessPoint)
+				}
+			},
+		},
+		{
+			name: "access point before auth profile",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    port: 22
+    auth_profile: profile
+    username: own
+    password_env: UNIFI_AP_TEST_SECRET
+    fingerprint: SHA256:own
+`,
+			check: func(t *testing.T, accessPoint AccessPointConfig) {
+				if accessPoint.Username != "own" || accessPoint.Password != "from-env" ||
+					accessPoint.KeyFile != "profile-key" || accessPoint.Port != 22 || accessPoint.Fingerprint != "SHA256:own" {
+					t.Errorf("access point settings not kept: %+v", accessPoint)
+				}
+			},
+		},
+		{
+			name: "proxy jump",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    proxy_jump: " bastion "
+`,
+			check: func(t *testing.T, accessPoint AccessPointConfig) {
+				if accessPoint.ProxyJump != "bastion" {
+					t.Errorf("got proxy_jump %q", accessPoint.ProxyJump)
+				}
+			},
+		},
+		{
+			name: "file source",
+			yaml: `
+  - name: ap
+    source: file
+    path: /tmp/ap-*.json
+    record: true
+`,
+			check: func(t *testing.T, accessPoint AccessPointConfig) {
+				if accessPoint.Source != SourceFile || accessPoint.Port != 2200 || !accessPoint.Record {
+					t.Errorf("unexpected access point %+v", accessPoint)
+				}
+			},
+		},
+		{
+			name: "unknown auth profile",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    auth_profile: missing
+`,
+			err: "accesspoint #1 refers to unknown auth profile `missing`",
+		},
+		{
+			name: "unknown jump host",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    proxy_jump: bastion,missing
+`,
+			err: "accesspoint #1 refers to unknown jump host `missing`",
+		},
+		{
+			name: "unknown source",
+			yaml: `
+  - name: ap
+    source: snmp
+`,
+			err: "accesspoint #1 has an unknown `source` snmp",
+		},
+		{
+			name: "missing address",
+			yaml: `
+  - name: ap
+`,
+			err: "accesspoint #1 is missing `address`",
+		},
+		{
+			name: "missing path",
+			yaml: `
+  - name: ap
+    source: file
+`,
+			err: "accesspoint #1 is missing `path`",
+		},
+		{
+			name: "certificate without key file",
+			yaml: `
+  - name: ap
+    address: 192.0.2.10
+    certfile: own-cert
+`,
+			err: "accesspoint #1 requires `keyfile` or `use_agent` for `certfile`",
+		},
+	}
+	t.Setenv("UNIFI_AP_TEST_SECRET", "from-env")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadConfig(t, header+strings.TrimPrefix(test.yaml, "\n"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, config.AccessPoints[0])
+		})
+	}
+}
+
+func TestProbeAccessPoint(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	tests := []struct {
+		name     string
+		yaml     string
+		target   string
+		auth     string
+		verified bool
+	}{
+		{
+			name:   "no host key verification",
+			yaml:   "defaults:\n  username: admin\n  password: secret\n",
+			target: "192.0.2.10",
+		},
+		{
+			name: "trust on first use",
+			yaml: "global:\n  known_hosts: " + knownHosts + "\n  trust_on_first_use: true\n" +
+				"defaults:\n  username: admin\n  password: secret\n",
+			target: "192.0.2.10",
+		},
+		{
+			name:     "known hosts",
+			yaml:     "global:\n  known_hosts: " + knownHosts + "\ndefaults:\n  username: admin\n  password: secret\n",
+			target:   "192.0.2.10:2222",
+			verified: true,
+		},
+		{
+			name: "pinned fingerprint",
+			yaml: "auth_profiles:\n  pinned:\n    username: admin\n    password: secret\n" +
+				"defaults:\n  fingerprint: SHA256:pinned\n",
+			target:   "192.0.2.10",
+			auth:     "pinned",
+			verified: true,
+		},
+		{
+			name: "unverified jump host",
+			yaml: "global:\n  proxy_jump: bastion\n" +
+				"jump_hosts:\n  bastion:\n    address: 192.0.2.1\n    username: jump\n    password: jump\n" +
+				"defaults:\n  username: admin\n  password: secret\n  fingerprint: SHA256:pinned\n",
+			target: "192.0.2.10",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := mustLoadConfig(t, test.yaml)
+			accessPoint, err := config.probeAccessPoint(test.target, test.auth)
+			if !test.verified {
+				if !errors.Is(err, errUnverifiedProbe) {
+					t.Errorf("got error %v, want %v", err, errUnverifiedProbe)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accessPoint.Name != test.target || accessPoint.Address != "192.0.2.10" || accessPoint.Username != "admin" {
+				t.Errorf("unexpected access point %+v", accessPoint)
+			}
+		})
+	}
+}
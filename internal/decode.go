@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A number that firmware may also encode as a string
+type FlexFloat float64
+
+// An integer that firmware may also encode as a string, or with a fraction
+type FlexInt int64
+
+func (f *FlexFloat) UnmarshalJSON(data []byte) error {
+	text, err := flexNumber(data)
+	if err != nil || text == "" {
+		return err
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(*f)}
+	}
+	*f = FlexFloat(value)
+	return nil
+}
+
+func (i *FlexInt) UnmarshalJSON(data []byte) error {
+	text, err := flexNumber(data)
+	if err != nil || text == "" {
+		return err
+	}
+	// Parse as integer first to keep the precision of large counters
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		*i = FlexInt(value)
+		return nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(*i)}
+	}
+	*i = FlexInt(value)
+	return nil
+}
+
+// The text of a number or string, empty for null or an empty string
+func flexNumber(data []byte) (string, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case json.Number:
+		return value.String(), nil
+	case string:
+		return strings.TrimSpace(value), nil
+	default:
+		return "", &json.UnmarshalTypeError{Value: jsonKind(value), Type: reflect.TypeOf(0.0)}
+	}
+}
+
+// Rewrites the raw output of matching access points before it is decoded
+type adapter struct {
+	model   string
+	version string
+	adapt   func(raw map[string]any)
+}
+
+// Models whose radios report the channel width with the PHY generation
+var wifi6Models = []string{"UAL6", "UALR6", "UAP6MP", "UAM6", "UAIW6", "UAE6"}
+
+var adapters = func() []adapter {
+	var adapters []adapter
+	for _, model := range wifi6Models {
+		adapters = append(adapters, adapter{model: model, adapt: adaptChannelWidth})
+	}
+	return adapters
+}()
+
+// Register a function that rewrites the raw output of access points of the
+// given model, or any model if empty, whose firmware version starts with the
+// given version, for output that cannot be decoded as is. Must be called
+// before the collector is started.
+func RegisterAdapter(model string, version string, adapt func(raw map[string]any)) {
+	adapters = append(adapters, adapter{model: model, version: version, adapt: adapt})
+}
+
+// Turn a channel width such as "HE80" or "EHT320" into the number of MHz
+func adaptChannelWidth(raw map[string]any) {
+	radios, _ := raw["radio_table"].([]any)
+	for _, radio := range radios {
+		radio, ok := radio.(map[string]any)
+		if !ok {
+			continue
+		}
+		if width, ok := radio["ht"].(string); ok {
+			radio["ht"] = strings.TrimLeft(width, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		}
+	}
+}
+
+// Decode the output of mca-dump. Fields of an unexpected type are dropped and
+// reported as decode warnings, instead of failing the whole access point.
+func decode(accessPoint AccessPointConfig, output []byte) (*AccessPointInfo, error) {
+	accessPointInfo := &AccessPointInfo{
+		Name:      accessPoint.Name,
+		Up:        true,
+		Raw:       output,
+		Timestamp: time.Now(),
+	}
+
+	var raw map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, &FetchError{Reason: ReasonParse, Err: err}
+	}
+	model, _ := raw["model"].(string)
+	version, _ := raw["version"].(string)
+	for _, adapter := range adapters {
+		if (adapter.model == "" || adapter.model == model) && strings.HasPrefix(version, adapter.version) {
+			adapter.adapt(raw)
+		}
+	}
+
+	_, accessPointInfo.DecodeWarnings = removeMismatches(raw, reflect.TypeOf(*accessPointInfo), "")
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonParse, Err: err}
+	}
+	if err := json.Unmarshal(data, accessPointInfo); err != nil {
+		return nil, &FetchError{Reason: ReasonParse, Err: err}
+	}
+
+	return accessPointInfo, nil
+}
+
+// Remove the values that do not fit the type they are decoded into, and return
+// what is left along with the path of each removed value. Array elements are
+// removed rather than set to null, as they would otherwise decode as empty
+// entries, such as stations without a MAC address.
+func removeMismatches(value any, t reflect.Type, path string) (any, []string) {
+	var removed []string
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, _ := value.(map[string]any)
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fieldValue, ok := object[name]
+			if !ok {
+				continue
+			}
+			fieldPath := strings.TrimPrefix(path+"."+name, ".")
+			if !fits(fieldValue, field.Type) {
+				delete(object, name)
+				removed = append(removed, fieldPath)
+				continue
+			}
+			var fieldRemoved []string
+			object[name], fieldRemoved = removeMismatches(fieldValue, field.Type, fieldPath)
+			removed = append(removed, fieldRemoved...)
+		}
+	case reflect.Slice:
+		array, ok := value.([]any)
+		if !ok {
+			break
+		}
+		kept := make([]any, 0, len(array))
+		for _, element := range array {
+			if element == nil || !fits(element, t.Elem()) {
+				removed = append(removed, path)
+				continue
+			}
+			element, elementRemoved := removeMismatches(element, t.Elem(), path)
+			kept = append(kept, element)
+			removed = append(removed, elementRemoved...)
+		}
+		value = kept
+	}
+	return value, removed
+}
+
+// Whether a decoded JSON value can be decoded into the type
+func fits(value any, t reflect.Type) bool {
+	if value == nil {
+		return true
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(FlexInt(0)) || t == reflect.TypeOf(FlexFloat(0)) {
+		text, ok := value.(string)
+		if !ok {
+			return jsonKind(value) == "number"
+		}
+		_, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		return err == nil || strings.TrimSpace(text) == ""
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return jsonKind(value) == "string"
+	case reflect.Bool:
+		return jsonKind(value) == "bool"
+	case reflect.Struct:
+		return jsonKind(value) == "object"
+	case reflect.Slice:
+		return jsonKind(value) == "array"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+		return jsonKind(value) == "number" && err == nil
+	case reflect.Float32, reflect.Float64:
+		return jsonKind(value) == "number"
+	}
+	return true
+}
+
+// The kind of a decoded JSON value, as named in json.UnmarshalTypeError
+func jsonKind(value any) string {
+	switch value.(type) {
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "null"
+}
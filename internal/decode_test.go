@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestFlexInt(t *testing.T) {
+	tests := []struct {
+		data  string
+		value FlexInt
+		err   bool
+	}{
+		{`42`, 42, false},
+		{`"42"`, 42, false},
+		{`" 42 "`, 42, false},
+		{`9007199254740993`, 9007199254740993, false},
+		{`"9007199254740993"`, 9007199254740993, false},
+		{`42.9`, 42, false},
+		{`"42.9"`, 42, false},
+		{`""`, 0, false},
+		{`null`, 0, false},
+		{`"n/a"`, 0, true},
+		{`true`, 0, true},
+		{`[1]`, 0, true},
+	}
+	for _, test := range tests {
+		var value FlexInt
+		err := json.Unmarshal([]byte(test.data), &value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.data, err)
+		}
+		if value != test.value {
+			t.Errorf("%s: got %d, want %d", test.data, value, test.value)
+		}
+	}
+}
+
+func TestFlexFloat(t *testing.T) {
+	tests := []struct {
+		data  string
+		value FlexFloat
+		err   bool
+	}{
+		{`1.5`, 1.5, false},
+		{`"1.5"`, 1.5, false},
+		{`"1e3"`, 1000, false},
+		{`""`, 0, false},
+		{`null`, 0, false},
+		{`"fast"`, 0, true},
+		{`{}`, 0, true},
+	}
+	for _, test := range tests {
+		var value FlexFloat
+		err := json.Unmarshal([]byte(test.data), &value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.data, err)
+		}
+		if value != test.value {
+			t.Errorf("%s: got %g, want %g", test.data, value, test.value)
+		}
+	}
+}
+
+// Decode like decode does, keeping numbers as json.Number
+func decodeRaw(t *testing.T, data string) any {
+	t.Helper()
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		data string
+		t    reflect.Type
+		fits bool
+	}{
+		{`"42"`, reflect.TypeOf(FlexInt(0)), true},
+		{`"4.2"`, reflect.TypeOf(FlexFloat(0)), true},
+		{`""`, reflect.TypeOf(FlexInt(0)), true},
+		{`"n/a"`, reflect.TypeOf(FlexInt(0)), false},
+		{`true`, reflect.TypeOf(FlexFloat(0)), false},
+		{`42`, reflect.TypeOf(""), false},
+		{`"42"`, reflect.TypeOf(0), false},
+		{`4.2`, reflect.TypeOf(0), false},
+		{`4.2`, reflect.TypeOf(0.0), true},
+		{`"yes"`, reflect.TypeOf(false), false},
+		{`{}`, reflect.TypeOf(&APUplink{}), true},
+		{`[]`, reflect.TypeOf(APUplink{}), false},
+		{`{}`, reflect.TypeOf([]APRadio{}), false},
+		{`null`, reflect.TypeOf(""), true},
+	}
+	for _, test := range tests {
+		if fits := fits(decodeRaw(t, test.data), test.t); fits != test.fits {
+			t.Errorf("%s into %s: got %t, want %t", test.data, test.t, fits, test.fits)
+		}
+	}
+}
+
+func TestRemoveMismatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		removed []string
+		result  string
+	}{
+		{
+			name:   "string encoded number",
+			data:   `{"uptime": "86400", "sys_stats": {"mem_used": "1024"}}`,
+			result: `{"sys_stats":{"mem_used":"1024"},"uptime":"86400"}`,
+		},
+		{
+			name:    "wrong typed field",
+			data:    `{"model": 7, "uptime": "n/a", "sys_stats": {"mem_used": [1]}}`,
+			removed: []string{"model", "sys_stats.mem_used", "uptime"},
+			result:  `{"sys_stats":{}}`,
+		},
+		{
+			name:    "bad slice element",
+			data:    `{"radio_table": [{"name": "wifi0", "ht": "40"}, "wifi1", {"name": "wifi2", "ht": true}]}`,
+			removed: []string{"radio_table", "radio_table.ht"},
+			result:  `{"radio_table":[{"ht":"40","name":"wifi0"},{"name":"wifi2"}]}`,
+		},
+		{
+			name:    "null and mistyped stations",
+			data:    `{"vap_table": [{"sta_table": [null, "x", {"mac": "02:00:00:00:01:01"}, 7]}]}`,
+			removed: []string{"vap_table.sta_table", "vap_table.sta_table", "vap_table.sta_table"},
+			result:  `{"vap_table":[{"sta_table":[{"mac":"02:00:00:00:01:01"}]}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := decodeRaw(t, test.data)
+			raw, removed := removeMismatches(raw, reflect.TypeOf(AccessPointInfo{}), "")
+			slices.Sort(removed)
+			if !slices.Equal(removed, test.removed) {
+				t.Errorf("removed %v, want %v", removed, test.removed)
+			}
+			result, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != test.result {
+				t.Errorf("got %s, want %s", result, test.result)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	output := []byte(`{
+		"model": "U7PG2",
+		"uptime": "86400",
+		"sys_stats": {"loadavg_1": "0.25", "mem_used": "oops"},
+		"radio_table": [{"name": "wifi0", "ht": "80"}, 5],
+		"vap_table": [{"name": "ath0", "sta_table": [
+			null,
+			"x",
+			{"mac": "02:00:00:00:01:01", "signal": "-60"},
+			{"mac": "02:00:00:00:01:02", "signal": "weak"}
+		]}]
+	}`)
+	accessPointInfo, err := decode(AccessPointConfig{Name: "ap"}, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !accessPointInfo.Up || accessPointInfo.Model != "U7PG2" || accessPointInfo.Uptime != 86400 {
+		t.Errorf("unexpected access point %+v", accessPointInfo)
+	}
+	if accessPointInfo.SysStats.LoadAvg1 != 0.25 || accessPointInfo.SysStats.MemUsed != 0 {
+		t.Errorf("unexpected sys_stats %+v", accessPointInfo.SysStats)
+	}
+	if len(accessPointInfo.RadioTable) != 1 || accessPointInfo.RadioTable[0].ChannelWidth != 80 {
+		t.Errorf("unexpected radio_table %+v", accessPointInfo.RadioTable)
+	}
+	// Empty stations would all have the same labels and fail the whole scrape
+	if stations := accessPointInfo.VAPTable[0].StationTable; len(stations) != 2 ||
+		stations[0].Mac != "02:00:00:00:01:01" || stations[1].Mac != "02:00:00:00:01:02" {
+		t.Errorf("unexpected sta_table %+v", stations)
+	}
+	warnings := []string{"sys_stats.mem_used", "radio_table", "vap_table.sta_table", "vap_table.sta_table",
+		"vap_table.sta_table.signal"}
+	if !slices.Equal(accessPointInfo.DecodeWarnings, warnings) {
+		t.Errorf("got warnings %v, want %v", accessPointInfo.DecodeWarnings, warnings)
+	}
+
+	if _, err := decode(AccessPointConfig{Name: "ap"}, output[:20]); err == nil {
+		t.Error("expected an error for truncated output")
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	defer func(registered []adapter) {
+		adapters = registered
+	}(slices.Clone(adapters))
+	RegisterAdapter("", "7.1.", func(raw map[string]any) {
+		raw["serial"] = "adapted"
+	})
+
+	tests := []struct {
+		name     string
+		output   string
+		width    FlexInt
+		serial   string
+		warnings []string
+	}{
+		{
+			name:   "WiFi 6 channel width",
+			output: `{"model": "UAL6", "version": "6.5.62", "radio_table": [{"name": "wifi1", "ht": "HE80"}]}`,
+			width:  80,
+		},
+		{
+			name:   "WiFi 6 numeric channel width",
+			output: `{"model": "UALR6", "version": "6.6.65", "radio_table": [{"name": "wifi1", "ht": 40}]}`,
+			width:  40,
+		},
+		{
+			name:     "other model",
+			output:   `{"model": "U7LT", "version": "6.6.77", "radio_table": [{"name": "wifi1", "ht": "HE80"}]}`,
+			warnings: []string{"radio_table.ht"},
+		},
+		{
+			name:   "registered for a firmware version",
+			output: `{"model": "U7LT", "version": "7.1.66", "radio_table": [{"name": "wifi1", "ht": "20"}]}`,
+			width:  20,
+			serial: "adapted",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accessPointInfo, err := decode(AccessPointConfig{Name: "ap"}, []byte(test.output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width := accessPointInfo.RadioTable[0].ChannelWidth; width != test.width {
+				t.Errorf("got channel width %d, want %d", width, test.width)
+			}
+			if accessPointInfo.Serial != test.serial {
+				t.Errorf("got serial %q, want %q", accessPointInfo.Serial, test.serial)
+			}
+			if !slices.Equal(accessPointInfo.DecodeWarnings, test.warnings) {
+				t.Errorf("got warnings %v, want %v", accessPointInfo.DecodeWarnings, test.warnings)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package internal
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -12,8 +15,23 @@ import (
 
 const namespace = "unifi_ap_"
 
+// Leave some room for the response to reach Prometheus before it gives up
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
 // Try to match unpoller metrics and labels as much as possible
 // See https://github.com/unpoller/unpoller/tree/master/pkg/promunifi
+type healthMetrics struct {
+	up                *prometheus.Desc
+	scrapeDuration    *prometheus.Desc
+	scrapeErrors      *prometheus.Desc
+	lastSuccess       *prometheus.Desc
+	lastPoll          *prometheus.Desc
+	hostKeyMismatches *prometheus.Desc
+	authInfo          *prometheus.Desc
+	circuitOpen       *prometheus.Desc
+	decodeWarnings    *prometheus.Desc
+}
+
 type deviceMetrics struct {
 	info         *prometheus.Desc
 	uptime       *prometheus.Desc
@@ -29,10 +47,31 @@ type deviceMetrics struct {
 	mem          *prometheus.Desc
 }
 
+type interfaceMetrics struct {
+	up               *prometheus.Desc
+	speed            *prometheus.Desc
+	fullDuplex       *prometheus.Desc
+	rxBytes          *prometheus.Desc
+	txBytes          *prometheus.Desc
+	rxPackets        *prometheus.Desc
+	txPackets        *prometheus.Desc
+	rxErrors         *prometheus.Desc
+	txErrors         *prometheus.Desc
+	rxDropped        *prometheus.Desc
+	txDropped        *prometheus.Desc
+	uplinkInfo       *prometheus.Desc
+	uplinkUp         *prometheus.Desc
+	uplinkSpeed      *prometheus.Desc
+	uplinkFullDuplex *prometheus.Desc
+}
+
 type radioMetrics struct {
 	currentAntennaGain *prometheus.Desc
 	maxTxpower         *prometheus.Desc
 	minTxpower         *prometheus.Desc
+	channel            *prometheus.Desc
+	channelWidth       *prometheus.Desc
+	channelUtilization *prometheus.Desc
 }
 
 type vapMetrics struct {
@@ -49,10 +88,24 @@ type vapMetrics struct {
 }
 
 type stationMetrics struct {
-	txBytes *prometheus.Desc
-	rxBytes *prometheus.Desc
-	noise   *prometheus.Desc
-	signal  *prometheus.Desc
+	info         *prometheus.Desc
+	txBytes      *prometheus.Desc
+	rxBytes      *prometheus.Desc
+	txPackets    *prometheus.Desc
+	rxPackets    *prometheus.Desc
+	txRetries    *prometheus.Desc
+	txRate       *prometheus.Desc
+	rxRate       *prometheus.Desc
+	noise        *prometheus.Desc
+	signal       *prometheus.Desc
+	rssi         *prometheus.Desc
+	ccq          *prometheus.Desc
+	uptime       *prometheus.Desc
+	idleTime     *prometheus.Desc
+	channelWidth *prometheus.Desc
+	phyMode      *prometheus.Desc
+	authorized   *prometheus.Desc
+	powerSave    *prometheus.Desc
 }
 
 type rogueMetrics struct {
@@ -62,23 +115,57 @@ type rogueMetrics struct {
 	signal    *prometheus.Desc
 }
 
+type reloadMetrics struct {
+	successful       *prometheus.Desc
+	successTimestamp *prometheus.Desc
+}
+
 type Exporter struct {
-	collector Collector
+	collector *Collector
+	reload    reloadMetrics
+	reloads   reloadStatus
+	health    healthMetrics
 	device    deviceMetrics
+	iface     interfaceMetrics
 	radio     radioMetrics
 	vap       vapMetrics
 	station   stationMetrics
 	rogue     rogueMetrics
 }
 
-func NewExporter(collector Collector) *Exporter {
+func NewExporter(collector *Collector) *Exporter {
+	var healthLabels = []string{"name"}
+	var errorLabels = []string{"name", "reason"}
+	var authLabels = []string{"name", "method"}
+	var warningLabels = []string{"name", "field"}
 	var deviceInfoLabels = []string{"ip", "mac", "model", "model_name", "name", "serial", "version"}
 	var deviceLabels = []string{"name", "model"}
+	var interfaceLabels = []string{"name", "interface"}
+	var uplinkInfoLabels = []string{"name", "switch", "port", "chassis_id"}
+	var uplinkLabels = []string{"name", "interface"}
 	var radioLabels = []string{"name", "radio", "radio_name"}
+	var utilizationLabels = []string{"name", "radio", "radio_name", "kind"}
 	var vapLabels = []string{"name", "vap_name", "bssid", "radio", "radio_name", "essid", "usage"}
-	var stationLabels = []string{"name", "vap_name", "hostname", "mac"}
+	var stationInfoLabels = []string{"name", "mac", "hostname", "ip", "oui", "vap_name", "essid", "radio", "is_guest"}
+	var stationLabels = []string{"name", "mac"}
+	var phyModeLabels = []string{"name", "mac", "mode"}
 	var rogueLabels = []string{"name", "radio", "bssid", "essid", "security"}
 
+	var ReloadMetrics = reloadMetrics{
+		successful:       prometheus.NewDesc(namespace+"config_last_reload_successful", "Last Configuration Reload Successful", nil, nil),
+		successTimestamp: prometheus.NewDesc(namespace+"config_last_reload_success_timestamp_seconds", "Time Of The Last Successful Configuration Reload", nil, nil),
+	}
+	var HealthMetrics = healthMetrics{
+		up:                prometheus.NewDesc(namespace+"up", "Access Point Reachable", healthLabels, nil),
+		scrapeDuration:    prometheus.NewDesc(namespace+"scrape_duration_seconds", "Access Point Scrape Duration", healthLabels, nil),
+		scrapeErrors:      prometheus.NewDesc(namespace+"scrape_errors_total", "Access Point Scrape Errors", errorLabels, nil),
+		lastSuccess:       prometheus.NewDesc(namespace+"last_success_timestamp_seconds", "Time Of The Last Successful Scrape", healthLabels, nil),
+		lastPoll:          prometheus.NewDesc(namespace+"last_poll_timestamp_seconds", "Time Of The Cached Poll", healthLabels, nil),
+		hostKeyMismatches: prometheus.NewDesc(namespace+"host_key_mismatches_total", "SSH Host Key Mismatches", healthLabels, nil),
+		authInfo:          prometheus.NewDesc(namespace+"auth_info", "SSH Authentication Method", authLabels, nil),
+		circuitOpen:       prometheus.NewDesc(namespace+"circuit_open", "Access Point Skipped After Consecutive Failures", healthLabels, nil),
+		decodeWarnings:    prometheus.NewDesc(namespace+"decode_warnings_total", "Fields Ignored For An Unexpected Type", warningLabels, nil),
+	}
 	var DeviceMetrics = deviceMetrics{
 		info:         prometheus.NewDesc(namespace+"info", "Device Information", deviceInfoLabels, nil),
 		uptime:       prometheus.NewDesc(namespace+"uptime_seconds", "Device Uptime", deviceLabels, nil),
@@ -93,10 +180,30 @@ func NewExporter(collector Collector) *Exporter {
 		cpu:          prometheus.NewDesc(namespace+"cpu_utilization_ratio", "System CPU % Utilized", deviceLabels, nil),
 		mem:          prometheus.NewDesc(namespace+"memory_utilization_ratio", "System Memory % Utilized", deviceLabels, nil),
 	}
+	var InterfaceMetrics = interfaceMetrics{
+		up:               prometheus.NewDesc(namespace+"interface_up", "Interface Up", interfaceLabels, nil),
+		speed:            prometheus.NewDesc(namespace+"interface_speed_bps", "Interface Link Speed", interfaceLabels, nil),
+		fullDuplex:       prometheus.NewDesc(namespace+"interface_full_duplex", "Interface Full Duplex", interfaceLabels, nil),
+		rxBytes:          prometheus.NewDesc(namespace+"interface_receive_bytes_total", "Interface Bytes Received", interfaceLabels, nil),
+		txBytes:          prometheus.NewDesc(namespace+"interface_transmit_bytes_total", "Interface Bytes Transmitted", interfaceLabels, nil),
+		rxPackets:        prometheus.NewDesc(namespace+"interface_receive_packets_total", "Interface Packets Received", interfaceLabels, nil),
+		txPackets:        prometheus.NewDesc(namespace+"interface_transmit_packets_total", "Interface Packets Transmitted", interfaceLabels, nil),
+		rxErrors:         prometheus.NewDesc(namespace+"interface_receive_errors_total", "Interface Receive Errors", interfaceLabels, nil),
+		txErrors:         prometheus.NewDesc(namespace+"interface_transmit_errors_total", "Interface Transmit Errors", interfaceLabels, nil),
+		rxDropped:        prometheus.NewDesc(namespace+"interface_receive_dropped_total", "Interface Received Packets Dropped", interfaceLabels, nil),
+		txDropped:        prometheus.NewDesc(namespace+"interface_transmit_dropped_total", "Interface Transmitted Packets Dropped", interfaceLabels, nil),
+		uplinkInfo:       prometheus.NewDesc(namespace+"uplink_info", "Uplink Switch Port", uplinkInfoLabels, nil),
+		uplinkUp:         prometheus.NewDesc(namespace+"uplink_up", "Uplink Up", uplinkLabels, nil),
+		uplinkSpeed:      prometheus.NewDesc(namespace+"uplink_speed_bps", "Uplink Link Speed", uplinkLabels, nil),
+		uplinkFullDuplex: prometheus.NewDesc(namespace+"uplink_full_duplex", "Uplink Full Duplex", uplinkLabels, nil),
+	}
 	var RadioMetrics = radioMetrics{
 		currentAntennaGain: prometheus.NewDesc(namespace+"radio_current_antenna_gain", "Radio Current Antenna Gain", radioLabels, nil),
 		maxTxpower:         prometheus.NewDesc(namespace+"radio_max_transmit_power", "Radio Maximum Transmit Power", radioLabels, nil),
 		minTxpower:         prometheus.NewDesc(namespace+"radio_min_transmit_power", "Radio Minimum Transmit Power", radioLabels, nil),
+		channel:            prometheus.NewDesc(namespace+"radio_channel", "Radio Channel", radioLabels, nil),
+		channelWidth:       prometheus.NewDesc(namespace+"radio_channel_width_mhz", "Radio Channel Width", radioLabels, nil),
+		channelUtilization: prometheus.NewDesc(namespace+"radio_channel_utilization_ratio", "Radio Channel Utilization", utilizationLabels, nil),
 	}
 	var VapMetrics = vapMetrics{
 		rxBytes:   prometheus.NewDesc(namespace+"vap_receive_bytes_total", "VAP Bytes Received", vapLabels, nil),
@@ -111,10 +218,24 @@ func NewExporter(collector Collector) *Exporter {
 		txTotal:   prometheus.NewDesc(namespace+"vap_transmit_total", "VAP Transmit Total", vapLabels, nil),
 	}
 	var StationMetrics = stationMetrics{
-		txBytes: prometheus.NewDesc(namespace+"station_transmit_bytes_total", "Station Bytes Transmitted", stationLabels, nil),
-		rxBytes: prometheus.NewDesc(namespace+"station_receive_bytes_total", "Station Bytes Received", stationLabels, nil),
-		noise:   prometheus.NewDesc(namespace+"station_noise", "Station Noise", stationLabels, nil),
-		signal:  prometheus.NewDesc(namespace+"station_signal", "Station Signal", stationLabels, nil),
+		info:         prometheus.NewDesc(namespace+"station_info", "Station Information", stationInfoLabels, nil),
+		txBytes:      prometheus.NewDesc(namespace+"station_transmit_bytes_total", "Station Bytes Transmitted", stationLabels, nil),
+		rxBytes:      prometheus.NewDesc(namespace+"station_receive_bytes_total", "Station Bytes Received", stationLabels, nil),
+		txPackets:    prometheus.NewDesc(namespace+"station_transmit_packets_total", "Station Packets Transmitted", stationLabels, nil),
+		rxPackets:    prometheus.NewDesc(namespace+"station_receive_packets_total", "Station Packets Received", stationLabels, nil),
+		txRetries:    prometheus.NewDesc(namespace+"station_transmit_retries_total", "Station Transmit Retries", stationLabels, nil),
+		txRate:       prometheus.NewDesc(namespace+"station_transmit_rate_bps", "Station Transmit Rate", stationLabels, nil),
+		rxRate:       prometheus.NewDesc(namespace+"station_receive_rate_bps", "Station Receive Rate", stationLabels, nil),
+		noise:        prometheus.NewDesc(namespace+"station_noise", "Station Noise", stationLabels, nil),
+		signal:       prometheus.NewDesc(namespace+"station_signal", "Station Signal", stationLabels, nil),
+		rssi:         prometheus.NewDesc(namespace+"station_rssi_db", "Station RSSI", stationLabels, nil),
+		ccq:          prometheus.NewDesc(namespace+"station_ccq_ratio", "Station Client Connection Quality", stationLabels, nil),
+		uptime:       prometheus.NewDesc(namespace+"station_uptime_seconds", "Station Connected Time", stationLabels, nil),
+		idleTime:     prometheus.NewDesc(namespace+"station_idle_seconds", "Station Idle Time", stationLabels, nil),
+		channelWidth: prometheus.NewDesc(namespace+"station_channel_width_mhz", "Station Channel Width", stationLabels, nil),
+		phyMode:      prometheus.NewDesc(namespace+"station_phy_mode_info", "Station Wireless Standard", phyModeLabels, nil),
+		authorized:   prometheus.NewDesc(namespace+"station_authorized", "Station Authorized", stationLabels, nil),
+		powerSave:    prometheus.NewDesc(namespace+"station_power_save", "Station In Power Save Mode", stationLabels, nil),
 	}
 	var RogueMetrics = rogueMetrics{
 		channel:   prometheus.NewDesc(namespace+"rogueap_channel", "RogueAP Channel", rogueLabels, nil),
@@ -125,7 +246,11 @@ func NewExporter(collector Collector) *Exporter {
 
 	return &Exporter{
 		collector: collector,
+		reload:    ReloadMetrics,
+		reloads:   reloadStatus{successful: true, timestamp: time.Now()},
+		health:    HealthMetrics,
 		device:    DeviceMetrics,
+		iface:     InterfaceMetrics,
 		radio:     RadioMetrics,
 		vap:       VapMetrics,
 		station:   StationMetrics,
@@ -134,6 +259,19 @@ func NewExporter(collector Collector) *Exporter {
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	// Reload metrics
+	ch <- e.reload.successful
+	ch <- e.reload.successTimestamp
+	// Health metrics
+	ch <- e.health.up
+	ch <- e.health.scrapeDuration
+	ch <- e.health.scrapeErrors
+	ch <- e.health.lastSuccess
+	ch <- e.health.lastPoll
+	ch <- e.health.hostKeyMismatches
+	ch <- e.health.authInfo
+	ch <- e.health.circuitOpen
+	ch <- e.health.decodeWarnings
 	// Device metrics
 	ch <- e.device.info
 	ch <- e.device.uptime
@@ -147,10 +285,29 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.device.memBuffer
 	ch <- e.device.cpu
 	ch <- e.device.mem
+	// Interface metrics
+	ch <- e.iface.up
+	ch <- e.iface.speed
+	ch <- e.iface.fullDuplex
+	ch <- e.iface.rxBytes
+	ch <- e.iface.txBytes
+	ch <- e.iface.rxPackets
+	ch <- e.iface.txPackets
+	ch <- e.iface.rxErrors
+	ch <- e.iface.txErrors
+	ch <- e.iface.rxDropped
+	ch <- e.iface.txDropped
+	ch <- e.iface.uplinkInfo
+	ch <- e.iface.uplinkUp
+	ch <- e.iface.uplinkSpeed
+	ch <- e.iface.uplinkFullDuplex
 	// Radio metrics
 	ch <- e.radio.currentAntennaGain
 	ch <- e.radio.maxTxpower
 	ch <- e.radio.minTxpower
+	ch <- e.radio.channel
+	ch <- e.radio.channelWidth
+	ch <- e.radio.channelUtilization
 	// Virtual Accesspoint metrics
 	ch <- e.vap.rxBytes
 	ch <- e.vap.rxDropped
@@ -163,10 +320,24 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.vap.txSuccess
 	ch <- e.vap.txTotal
 	// Station (client) metrics
+	ch <- e.station.info
 	ch <- e.station.rxBytes
 	ch <- e.station.txBytes
+	ch <- e.station.rxPackets
+	ch <- e.station.txPackets
+	ch <- e.station.txRetries
+	ch <- e.station.rxRate
+	ch <- e.station.txRate
 	ch <- e.station.noise
 	ch <- e.station.signal
+	ch <- e.station.rssi
+	ch <- e.station.ccq
+	ch <- e.station.uptime
+	ch <- e.station.idleTime
+	ch <- e.station.channelWidth
+	ch <- e.station.phyMode
+	ch <- e.station.authorized
+	ch <- e.station.powerSave
 	// Rogue AP (others) metrics
 	ch <- e.rogue.channel
 	ch <- e.rogue.frequency
@@ -174,117 +345,336 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.rogue.signal
 }
 
+// Binds a collection to the context of a single scrape
+type scrape struct {
+	exporter *Exporter
+	ctx      context.Context
+}
+
+func (s *scrape) Describe(ch chan<- *prometheus.Desc) {
+	s.exporter.Describe(ch)
+}
+
+func (s *scrape) Collect(ch chan<- prometheus.Metric) {
+	s.exporter.collect(s.ctx, ch)
+}
+
 func (e *Exporter) Run() {
-	prometheus.MustRegister(e)
-	http.Handle("/metrics", promhttp.Handler())
-	log.Info("listening for requests on port ", e.collector.config.Global.ListenPort)
-	log.Fatal(http.ListenAndServe(fmt.Sprint(":", e.collector.config.Global.ListenPort), nil))
+	e.collector.Poll(context.Background())
+	e.handleSignals()
+	http.HandleFunc("/metrics", e.handleMetrics)
+	http.HandleFunc("/probe", e.handleProbe)
+	http.HandleFunc("/-/reload", e.handleReload)
+	http.HandleFunc("/debug/dump", e.handleDump)
+	errs := make(chan error)
+	for _, listenAddress := range e.collector.Config().Global.ListenAddresses {
+		log.Info("listening for requests on ", listenAddress)
+		go func() {
+			errs <- http.ListenAndServe(listenAddress, nil)
+		}()
+	}
+	log.Fatal(<-errs)
 }
 
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	accessPointInfos, err := e.collector.Collect()
-	if err != nil {
-		log.Errorf("collect failed: %s", err)
-		return
+// Use the scrape timeout sent by Prometheus, capped by the configured timeout
+func (e *Exporter) scrapeTimeout(r *http.Request) time.Duration {
+	timeout := e.collector.Config().Global.Timeout
+	if header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		seconds, err := strconv.ParseFloat(header, 64)
+		if err != nil {
+			log.Warnf("invalid scrape timeout %q: %s", header, err)
+		} else if scrapeTimeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset; scrapeTimeout > 0 && scrapeTimeout < timeout {
+			timeout = scrapeTimeout
+		}
+	}
+	return timeout
+}
+
+func (e *Exporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), e.scrapeTimeout(r))
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&scrape{exporter: e, ctx: ctx})
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	var accessPointInfos *[]AccessPointInfo
+	polling := e.collector.Polling()
+	if polling {
+		accessPointInfos = e.collector.Cached()
+	} else {
+		var err error
+		accessPointInfos, err = e.collector.Collect(ctx)
+		if err != nil {
+			log.Errorf("collect failed: %s", err)
+			return
+		}
 	}
 
 	for _, accessPointInfo := range *accessPointInfos {
-		// Device info
-		ch <- prometheus.MustNewConstMetric(e.device.info, prometheus.GaugeValue, accessPointInfo.Value,
-			accessPointInfo.IP, accessPointInfo.Mac, accessPointInfo.Model, accessPointInfo.ModelName,
-			accessPointInfo.Name, accessPointInfo.Serial, accessPointInfo.Version)
-		ch <- prometheus.MustNewConstMetric(e.device.uptime, prometheus.GaugeValue, float64(accessPointInfo.Uptime),
-			accessPointInfo.Name, accessPointInfo.Model)
-		// Bytes sent and received
-		var txTotal = int64(0)
-		var rxTotal = int64(0)
-		for _, i := range accessPointInfo.InterfaceTable {
-			if i.Up {
-				txTotal += i.TxBytes
-				rxTotal += i.RxBytes
-			}
+		if polling {
+			ch <- prometheus.MustNewConstMetric(e.health.lastPoll, prometheus.GaugeValue, float64(accessPointInfo.Timestamp.Unix()),
+				accessPointInfo.Name)
 		}
-		ch <- prometheus.MustNewConstMetric(e.device.totalTxBytes, prometheus.CounterValue, float64(txTotal),
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.totalRxBytes, prometheus.CounterValue, float64(rxTotal),
-			accessPointInfo.Name, accessPointInfo.Model)
-
-		// CPU and memory
-		ch <- prometheus.MustNewConstMetric(e.device.loadAvg1, prometheus.GaugeValue, accessPointInfo.SysStats.LoadAvg1,
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.loadAvg5, prometheus.GaugeValue, accessPointInfo.SysStats.LoadAvg5,
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.loadAvg15, prometheus.GaugeValue, accessPointInfo.SysStats.LoadAvg15,
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.memUsed, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemUsed),
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.memTotal, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemTotal),
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.memBuffer, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemBuffer),
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.cpu, prometheus.GaugeValue, accessPointInfo.SystemStats.CPU,
-			accessPointInfo.Name, accessPointInfo.Model)
-		ch <- prometheus.MustNewConstMetric(e.device.mem, prometheus.GaugeValue, accessPointInfo.SystemStats.Mem,
-			accessPointInfo.Name, accessPointInfo.Model)
-
-		// Radio
-		for _, radio := range accessPointInfo.RadioTable {
-			ch <- prometheus.MustNewConstMetric(e.radio.currentAntennaGain, prometheus.GaugeValue, float64(radio.CurrentAntennaGain),
-				accessPointInfo.Name, radio.Radio, radio.RadioName)
-			ch <- prometheus.MustNewConstMetric(e.radio.maxTxpower, prometheus.GaugeValue, float64(radio.MaxTxpower),
-				accessPointInfo.Name, radio.Radio, radio.RadioName)
-			ch <- prometheus.MustNewConstMetric(e.radio.minTxpower, prometheus.GaugeValue, float64(radio.MinTxpower),
-				accessPointInfo.Name, radio.Radio, radio.RadioName)
 
-			// Rogue AP (others)
-			for _, rogue := range radio.ScanTable {
-				ch <- prometheus.MustNewConstMetric(e.rogue.frequency, prometheus.GaugeValue, float64(rogue.Frequency),
-					accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
-				ch <- prometheus.MustNewConstMetric(e.rogue.channel, prometheus.GaugeValue, float64(rogue.Channel),
-					accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
-				ch <- prometheus.MustNewConstMetric(e.rogue.noise, prometheus.GaugeValue, float64(rogue.Noise),
-					accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
-				ch <- prometheus.MustNewConstMetric(e.rogue.signal, prometheus.GaugeValue, float64(rogue.Signal),
-					accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
-			}
+		e.collectAccessPoint(ch, accessPointInfo)
+	}
+
+	// Reload
+	successful, timestamp := e.reloads.get()
+	ch <- prometheus.MustNewConstMetric(e.reload.successful, prometheus.GaugeValue, successful)
+	ch <- prometheus.MustNewConstMetric(e.reload.successTimestamp, prometheus.GaugeValue, float64(timestamp.Unix()))
+
+	// Health
+	for _, status := range e.collector.Status() {
+		e.collectStatus(ch, status)
+	}
+}
+
+func (e *Exporter) collectStatus(ch chan<- prometheus.Metric, status AccessPointStatus) {
+	for _, reason := range Reasons {
+		ch <- prometheus.MustNewConstMetric(e.health.scrapeErrors, prometheus.CounterValue, status.Errors[reason],
+			status.Name, reason)
+	}
+	ch <- prometheus.MustNewConstMetric(e.health.hostKeyMismatches, prometheus.CounterValue, status.Errors[ReasonHostKey],
+		status.Name)
+	for field, count := range status.DecodeWarnings {
+		ch <- prometheus.MustNewConstMetric(e.health.decodeWarnings, prometheus.CounterValue, count,
+			status.Name, field)
+	}
+	var circuitOpen = 0.0
+	if time.Now().Before(status.CircuitOpenUntil) {
+		circuitOpen = 1
+	}
+	ch <- prometheus.MustNewConstMetric(e.health.circuitOpen, prometheus.GaugeValue, circuitOpen,
+		status.Name)
+	if status.AuthMethod != "" {
+		ch <- prometheus.MustNewConstMetric(e.health.authInfo, prometheus.GaugeValue, 1,
+			status.Name, status.AuthMethod)
+	}
+	if !status.LastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(e.health.lastSuccess, prometheus.GaugeValue, float64(status.LastSuccess.Unix()),
+			status.Name)
+	}
+}
+
+func (e *Exporter) collectAccessPoint(ch chan<- prometheus.Metric, accessPointInfo AccessPointInfo) {
+	// Health
+	var up = 0.0
+	if accessPointInfo.Up {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(e.health.up, prometheus.GaugeValue, up,
+		accessPointInfo.Name)
+	ch <- prometheus.MustNewConstMetric(e.health.scrapeDuration, prometheus.GaugeValue, accessPointInfo.Duration.Seconds(),
+		accessPointInfo.Name)
+	if !accessPointInfo.Up {
+		return
+	}
+
+	// Device info
+	ch <- prometheus.MustNewConstMetric(e.device.info, prometheus.GaugeValue, 1,
+		accessPointInfo.IP, accessPointInfo.Mac, accessPointInfo.Model, accessPointInfo.ModelName,
+		accessPointInfo.Name, accessPointInfo.Serial, accessPointInfo.Version)
+	ch <- prometheus.MustNewConstMetric(e.device.uptime, prometheus.GaugeValue, float64(accessPointInfo.Uptime),
+		accessPointInfo.Name, accessPointInfo.Model)
+	// Bytes sent and received
+	var txTotal = int64(0)
+	var rxTotal = int64(0)
+	for _, i := range accessPointInfo.InterfaceTable {
+		if i.Up {
+			txTotal += int64(i.TxBytes)
+			rxTotal += int64(i.RxBytes)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(e.device.totalTxBytes, prometheus.CounterValue, float64(txTotal),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.totalRxBytes, prometheus.CounterValue, float64(rxTotal),
+		accessPointInfo.Name, accessPointInfo.Model)
+
+	// CPU and memory
+	ch <- prometheus.MustNewConstMetric(e.device.loadAvg1, prometheus.GaugeValue, float64(accessPointInfo.SysStats.LoadAvg1),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.loadAvg5, prometheus.GaugeValue, float64(accessPointInfo.SysStats.LoadAvg5),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.loadAvg15, prometheus.GaugeValue, float64(accessPointInfo.SysStats.LoadAvg15),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.memUsed, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemUsed),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.memTotal, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemTotal),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.memBuffer, prometheus.GaugeValue, float64(accessPointInfo.SysStats.MemBuffer),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.cpu, prometheus.GaugeValue, float64(accessPointInfo.SystemStats.CPU),
+		accessPointInfo.Name, accessPointInfo.Model)
+	ch <- prometheus.MustNewConstMetric(e.device.mem, prometheus.GaugeValue, float64(accessPointInfo.SystemStats.Mem),
+		accessPointInfo.Name, accessPointInfo.Model)
+
+	// Interfaces, the port table only adds those missing from the interface table
+	seen := map[string]bool{}
+	for _, i := range slices.Concat(accessPointInfo.InterfaceTable, accessPointInfo.PortTable) {
+		name := i.Interface()
+		if name == "" || seen[name] {
+			continue
 		}
+		seen[name] = true
+		ch <- prometheus.MustNewConstMetric(e.iface.up, prometheus.GaugeValue, boolValue(i.Up),
+			accessPointInfo.Name, name)
+		// Speed is in Mbps
+		ch <- prometheus.MustNewConstMetric(e.iface.speed, prometheus.GaugeValue, float64(i.Speed)*1000000,
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.fullDuplex, prometheus.GaugeValue, boolValue(i.FullDuplex),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.rxBytes, prometheus.CounterValue, float64(i.RxBytes),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.txBytes, prometheus.CounterValue, float64(i.TxBytes),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.rxPackets, prometheus.CounterValue, float64(i.RxPackets),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.txPackets, prometheus.CounterValue, float64(i.TxPackets),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.rxErrors, prometheus.CounterValue, float64(i.RxErrors),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.txErrors, prometheus.CounterValue, float64(i.TxErrors),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.rxDropped, prometheus.CounterValue, float64(i.RxDropped),
+			accessPointInfo.Name, name)
+		ch <- prometheus.MustNewConstMetric(e.iface.txDropped, prometheus.CounterValue, float64(i.TxDropped),
+			accessPointInfo.Name, name)
+	}
+
+	// Uplink
+	if switchName, port, chassisID := accessPointInfo.UplinkSwitch(); switchName != "" || port != "" || chassisID != "" {
+		ch <- prometheus.MustNewConstMetric(e.iface.uplinkInfo, prometheus.GaugeValue, 1,
+			accessPointInfo.Name, switchName, port, chassisID)
+	}
+	if uplink := accessPointInfo.Uplink; uplink != nil {
+		ch <- prometheus.MustNewConstMetric(e.iface.uplinkUp, prometheus.GaugeValue, boolValue(uplink.Up),
+			accessPointInfo.Name, uplink.Name)
+		ch <- prometheus.MustNewConstMetric(e.iface.uplinkSpeed, prometheus.GaugeValue, float64(uplink.Speed)*1000000,
+			accessPointInfo.Name, uplink.Name)
+		ch <- prometheus.MustNewConstMetric(e.iface.uplinkFullDuplex, prometheus.GaugeValue, boolValue(uplink.FullDuplex),
+			accessPointInfo.Name, uplink.Name)
+	}
+
+	// Radio
+	radioStats := map[string]APRadioStats{}
+	for _, stats := range accessPointInfo.RadioStats {
+		radioStats[stats.RadioName] = stats
+	}
+	for _, radio := range accessPointInfo.RadioTable {
+		ch <- prometheus.MustNewConstMetric(e.radio.currentAntennaGain, prometheus.GaugeValue, float64(radio.CurrentAntennaGain),
+			accessPointInfo.Name, radio.Radio, radio.RadioName)
+		ch <- prometheus.MustNewConstMetric(e.radio.maxTxpower, prometheus.GaugeValue, float64(radio.MaxTxpower),
+			accessPointInfo.Name, radio.Radio, radio.RadioName)
+		ch <- prometheus.MustNewConstMetric(e.radio.minTxpower, prometheus.GaugeValue, float64(radio.MinTxpower),
+			accessPointInfo.Name, radio.Radio, radio.RadioName)
+		ch <- prometheus.MustNewConstMetric(e.radio.channelWidth, prometheus.GaugeValue, float64(radio.ChannelWidth),
+			accessPointInfo.Name, radio.Radio, radio.RadioName)
 
-		// Virtual Accesspoint
-		for _, vap := range accessPointInfo.VAPTable {
-			ch <- prometheus.MustNewConstMetric(e.vap.rxBytes, prometheus.CounterValue, float64(vap.RxBytes),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.rxDropped, prometheus.CounterValue, float64(vap.RxDropped),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.rxErrors, prometheus.CounterValue, float64(vap.RxErrors),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txBytes, prometheus.CounterValue, float64(vap.TxBytes),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txDropped, prometheus.CounterValue, float64(vap.TxDropped),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txErrors, prometheus.CounterValue, float64(vap.TxErrors),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txPower, prometheus.GaugeValue, float64(vap.TxPower),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txRetries, prometheus.CounterValue, float64(vap.TxRetries),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txSuccess, prometheus.CounterValue, float64(vap.TxSuccess),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-			ch <- prometheus.MustNewConstMetric(e.vap.txTotal, prometheus.CounterValue, float64(vap.TxTotal),
-				accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
-
-			// Station (client)
-			for _, station := range vap.StationTable {
-				ch <- prometheus.MustNewConstMetric(e.station.rxBytes, prometheus.CounterValue, float64(station.RxBytes),
-					accessPointInfo.Name, vap.Name, station.Hostname, station.Mac)
-				ch <- prometheus.MustNewConstMetric(e.station.txBytes, prometheus.CounterValue, float64(station.TxBytes),
-					accessPointInfo.Name, vap.Name, station.Hostname, station.Mac)
-				ch <- prometheus.MustNewConstMetric(e.station.noise, prometheus.CounterValue, float64(station.Noise),
-					accessPointInfo.Name, vap.Name, station.Hostname, station.Mac)
-				ch <- prometheus.MustNewConstMetric(e.station.signal, prometheus.CounterValue, float64(station.Signal),
-					accessPointInfo.Name, vap.Name, station.Hostname, station.Mac)
+		// Channel and utilization, in percent
+		if stats, ok := radioStats[radio.RadioName]; ok {
+			ch <- prometheus.MustNewConstMetric(e.radio.channel, prometheus.GaugeValue, float64(stats.Channel),
+				accessPointInfo.Name, radio.Radio, radio.RadioName)
+			ch <- prometheus.MustNewConstMetric(e.radio.channelUtilization, prometheus.GaugeValue, float64(stats.CUTotal)/100,
+				accessPointInfo.Name, radio.Radio, radio.RadioName, "total")
+			ch <- prometheus.MustNewConstMetric(e.radio.channelUtilization, prometheus.GaugeValue, float64(stats.CUSelfRx)/100,
+				accessPointInfo.Name, radio.Radio, radio.RadioName, "self_rx")
+			ch <- prometheus.MustNewConstMetric(e.radio.channelUtilization, prometheus.GaugeValue, float64(stats.CUSelfTx)/100,
+				accessPointInfo.Name, radio.Radio, radio.RadioName, "self_tx")
+			if stats.CUInterference != nil {
+				ch <- prometheus.MustNewConstMetric(e.radio.channelUtilization, prometheus.GaugeValue, float64(*stats.CUInterference)/100,
+					accessPointInfo.Name, radio.Radio, radio.RadioName, "interference")
 			}
 		}
 
+		// Rogue AP (others)
+		for _, rogue := range radio.ScanTable {
+			ch <- prometheus.MustNewConstMetric(e.rogue.frequency, prometheus.GaugeValue, float64(rogue.Frequency),
+				accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
+			ch <- prometheus.MustNewConstMetric(e.rogue.channel, prometheus.GaugeValue, float64(rogue.Channel),
+				accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
+			ch <- prometheus.MustNewConstMetric(e.rogue.noise, prometheus.GaugeValue, float64(rogue.Noise),
+				accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
+			ch <- prometheus.MustNewConstMetric(e.rogue.signal, prometheus.GaugeValue, float64(rogue.Signal),
+				accessPointInfo.Name, radio.Radio, rogue.BSSID, rogue.ESSID, rogue.Security)
+		}
+	}
+
+	// Virtual Accesspoint
+	for _, vap := range accessPointInfo.VAPTable {
+		ch <- prometheus.MustNewConstMetric(e.vap.rxBytes, prometheus.CounterValue, float64(vap.RxBytes),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.rxDropped, prometheus.CounterValue, float64(vap.RxDropped),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.rxErrors, prometheus.CounterValue, float64(vap.RxErrors),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txBytes, prometheus.CounterValue, float64(vap.TxBytes),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txDropped, prometheus.CounterValue, float64(vap.TxDropped),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txErrors, prometheus.CounterValue, float64(vap.TxErrors),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txPower, prometheus.GaugeValue, float64(vap.TxPower),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txRetries, prometheus.CounterValue, float64(vap.TxRetries),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txSuccess, prometheus.CounterValue, float64(vap.TxSuccess),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+		ch <- prometheus.MustNewConstMetric(e.vap.txTotal, prometheus.CounterValue, float64(vap.TxTotal),
+			accessPointInfo.Name, vap.Name, vap.BSSID, vap.Radio, vap.RadioName, vap.ESSID, vap.Usage)
+
+		// Station (client)
+		for _, station := range vap.StationTable {
+			ch <- prometheus.MustNewConstMetric(e.station.info, prometheus.GaugeValue, 1,
+				accessPointInfo.Name, station.Mac, station.Hostname, station.IP, station.OUI, vap.Name, vap.ESSID, vap.Radio,
+				strconv.FormatBool(station.IsGuest))
+			ch <- prometheus.MustNewConstMetric(e.station.rxBytes, prometheus.CounterValue, float64(station.RxBytes),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.txBytes, prometheus.CounterValue, float64(station.TxBytes),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.noise, prometheus.GaugeValue, float64(station.Noise),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.signal, prometheus.GaugeValue, float64(station.Signal),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.rxPackets, prometheus.CounterValue, float64(station.RxPackets),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.txPackets, prometheus.CounterValue, float64(station.TxPackets),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.txRetries, prometheus.CounterValue, float64(station.TxRetries),
+				accessPointInfo.Name, station.Mac)
+			// Rates are in kbps
+			ch <- prometheus.MustNewConstMetric(e.station.rxRate, prometheus.GaugeValue, float64(station.RxRate)*1000,
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.txRate, prometheus.GaugeValue, float64(station.TxRate)*1000,
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.rssi, prometheus.GaugeValue, float64(station.RSSI),
+				accessPointInfo.Name, station.Mac)
+			// CCQ is in tenths of a percent
+			ch <- prometheus.MustNewConstMetric(e.station.ccq, prometheus.GaugeValue, float64(station.CCQ)/1000,
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.uptime, prometheus.GaugeValue, float64(station.Uptime),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.idleTime, prometheus.GaugeValue, float64(station.IdleTime),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.channelWidth, prometheus.GaugeValue, float64(station.ChannelWidth),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.phyMode, prometheus.GaugeValue, 1,
+				accessPointInfo.Name, station.Mac, station.PhyMode())
+			ch <- prometheus.MustNewConstMetric(e.station.authorized, prometheus.GaugeValue, boolValue(station.Authorized),
+				accessPointInfo.Name, station.Mac)
+			ch <- prometheus.MustNewConstMetric(e.station.powerSave, prometheus.GaugeValue, boolValue(station.PowerSave),
+				accessPointInfo.Name, station.Mac)
+		}
 	}
+}
 
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"math"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Scrape an access point named ap that replays the fixture, returning the
+// value of every series by its name and labels
+func scrapeFixture(t *testing.T, fixture string) map[string]float64 {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ap.json")
+	if err := os.WriteFile(path, []byte(fixture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := mustLoadConfig(t, "accesspoints:\n  - name: ap\n    source: file\n    path: "+path+"\n")
+	exporter := NewExporter(NewCollector(*config))
+
+	recorder := httptest.NewRecorder()
+	exporter.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != 200 {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body)
+	}
+	metrics := map[string]float64{}
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		i := strings.LastIndex(line, " ")
+		if line == "" || strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+		metrics[line[:i]] = value
+	}
+	if metrics[`unifi_ap_up{name="ap"}`] != 1 {
+		t.Fatalf("access point is down: %s", recorder.Body)
+	}
+	return metrics
+}
+
+// Check the value of the series, where NaN means the series must be missing
+func checkMetrics(t *testing.T, metrics map[string]float64, want map[string]float64) {
+	t.Helper()
+	for series, want := range want {
+		value, ok := metrics[series]
+		switch {
+		case math.IsNaN(want):
+			if ok {
+				t.Errorf("unexpected %s %g", series, value)
+			}
+		case !ok:
+			t.Errorf("missing %s", series)
+		case math.Abs(value-want) > 1e-9:
+			t.Errorf("got %s %g, want %g", series, value, want)
+		}
+	}
+}
+
+func TestRadioMetrics(t *testing.T) {
+	metrics := scrapeFixture(t, `{
+		"radio_table": [
+			{"radio": "ng", "name": "wifi0", "ht": "40"},
+			{"radio": "na", "name": "wifi1", "ht": 80}
+		],
+		"radio_table_stats": [
+			{"name": "wifi0", "channel": "6", "cu_total": "55", "cu_self_rx": 20, "cu_self_tx": 10, "cu_interference": 25},
+			{"name": "wifi1", "channel": 149, "cu_total": 3, "cu_self_rx": 1, "cu_self_tx": 2},
+			{"name": "wifi9", "channel": 1, "cu_total": 99}
+		]
+	}`)
+	checkMetrics(t, metrics, map[string]float64{
+		`unifi_ap_radio_channel{name="ap",radio="ng",radio_name="wifi0"}`:                                       6,
+		`unifi_ap_radio_channel_width_mhz{name="ap",radio="ng",radio_name="wifi0"}`:                             40,
+		`unifi_ap_radio_channel_utilization_ratio{kind="total",name="ap",radio="ng",radio_name="wifi0"}`:        0.55,
+		`unifi_ap_radio_channel_utilization_ratio{kind="self_rx",name="ap",radio="ng",radio_name="wifi0"}`:      0.2,
+		`unifi_ap_radio_channel_utilization_ratio{kind="self_tx",name="ap",radio="ng",radio_name="wifi0"}`:      0.1,
+		`unifi_ap_radio_channel_utilization_ratio{kind="interference",name="ap",radio="ng",radio_name="wifi0"}`: 0.25,
+		`unifi_ap_radio_channel{name="ap",radio="na",radio_name="wifi1"}`:                                       149,
+		`unifi_ap_radio_channel_width_mhz{name="ap",radio="na",radio_name="wifi1"}`:                             80,
+		`unifi_ap_radio_channel_utilization_ratio{kind="total",name="ap",radio="na",radio_name="wifi1"}`:        0.03,
+		`unifi_ap_radio_channel_utilization_ratio{kind="interference",name="ap",radio="na",radio_name="wifi1"}`: math.NaN(),
+	})
+	for series := range metrics {
+		if strings.Contains(series, "wifi9") {
+			t.Errorf("stats without a radio reported as %s", series)
+		}
+	}
+}
+
+func TestStationMetrics(t *testing.T) {
+	metrics := scrapeFixture(t, `{
+		"vap_table": [{
+			"name": "ath0", "radio": "na", "essid": "example",
+			"sta_table": [
+				{
+					"mac": "02:00:00:00:01:01", "hostname": "laptop", "ip": "192.0.2.101", "oui": "Intel",
+					"tx_rate": 866700, "rx_rate": "780000", "ccq": 914, "rssi": 47, "signal": -49,
+					"uptime": 7200, "idletime": 15, "tx_packets": 16384, "rx_packets": 8192, "tx_retries": 12,
+					"chwidth": 80, "is_11n": true, "is_11ac": true, "is_11ax": false,
+					"authorized": true, "state_pwrmgt": true
+				},
+				{"mac": "02:00:00:00:01:02", "is_guest": true, "is_11n": true, "is_11ax": true},
+				{"mac": "02:00:00:00:01:03"}
+			]
+		}]
+	}`)
+	checkMetrics(t, metrics, map[string]float64{
+		`unifi_ap_station_info{essid="example",hostname="laptop",ip="192.0.2.101",is_guest="false",mac="02:00:00:00:01:01",name="ap",oui="Intel",radio="na",vap_name="ath0"}`: 1,
+		`unifi_ap_station_transmit_rate_bps{mac="02:00:00:00:01:01",name="ap"}`:                                                                                               866700000,
+		`unifi_ap_station_receive_rate_bps{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                780000000,
+		`unifi_ap_station_ccq_ratio{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                       0.914,
+		`unifi_ap_station_rssi_db{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                         47,
+		`unifi_ap_station_signal{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                          -49,
+		`unifi_ap_station_uptime_seconds{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                  7200,
+		`unifi_ap_station_idle_seconds{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                    15,
+		`unifi_ap_station_transmit_packets_total{mac="02:00:00:00:01:01",name="ap"}`:                                                                                          16384,
+		`unifi_ap_station_receive_packets_total{mac="02:00:00:00:01:01",name="ap"}`:                                                                                           8192,
+		`unifi_ap_station_transmit_retries_total{mac="02:00:00:00:01:01",name="ap"}`:                                                                                          12,
+		`unifi_ap_station_channel_width_mhz{mac="02:00:00:00:01:01",name="ap"}`:                                                                                               80,
+		`unifi_ap_station_phy_mode_info{mac="02:00:00:00:01:01",mode="ac",name="ap"}`:                                                                                         1,
+		`unifi_ap_station_authorized{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                      1,
+		`unifi_ap_station_power_save{mac="02:00:00:00:01:01",name="ap"}`:                                                                                                      1,
+		`unifi_ap_station_info{essid="example",hostname="",ip="",is_guest="true",mac="02:00:00:00:01:02",name="ap",oui="",radio="na",vap_name="ath0"}`:                        1,
+		`unifi_ap_station_phy_mode_info{mac="02:00:00:00:01:02",mode="ax",name="ap"}`:                                                                                         1,
+		`unifi_ap_station_phy_mode_info{mac="02:00:00:00:01:03",mode="legacy",name="ap"}`:                                                                                     1,
+		`unifi_ap_station_authorized{mac="02:00:00:00:01:03",name="ap"}`:                                                                                                      0,
+		`unifi_ap_station_power_save{mac="02:00:00:00:01:03",name="ap"}`:                                                                                                      0,
+	})
+}
+
+func TestInterfaceMetrics(t *testing.T) {
+	metrics := scrapeFixture(t, `{
+		"if_table": [
+			{"name": "eth0", "up": true, "speed": 100, "full_duplex": false, "rx_bytes": 1000, "tx_bytes": 2000,
+				"rx_packets": 10, "tx_packets": 20, "rx_errors": 3, "tx_errors": 4, "rx_dropped": 5, "tx_dropped": 6},
+			{"name": "br0", "up": true, "speed": 0, "rx_bytes": 100, "tx_bytes": 200}
+		],
+		"port_table": [
+			{"name": "Main", "ifname": "eth0", "up": true, "speed": 1000, "full_duplex": true, "rx_bytes": 9999},
+			{"name": "Secondary", "ifname": "eth1", "up": false, "speed": "10", "rx_errors": 7}
+		]
+	}`)
+	checkMetrics(t, metrics, map[string]float64{
+		// The interface table takes precedence over the port table
+		`unifi_ap_interface_speed_bps{interface="eth0",name="ap"}`:              100e6,
+		`unifi_ap_interface_full_duplex{interface="eth0",name="ap"}`:            0,
+		`unifi_ap_interface_up{interface="eth0",name="ap"}`:                     1,
+		`unifi_ap_interface_receive_bytes_total{interface="eth0",name="ap"}`:    1000,
+		`unifi_ap_interface_transmit_bytes_total{interface="eth0",name="ap"}`:   2000,
+		`unifi_ap_interface_receive_packets_total{interface="eth0",name="ap"}`:  10,
+		`unifi_ap_interface_transmit_packets_total{interface="eth0",name="ap"}`: 20,
+		`unifi_ap_interface_receive_errors_total{interface="eth0",name="ap"}`:   3,
+		`unifi_ap_interface_transmit_errors_total{interface="eth0",name="ap"}`:  4,
+		`unifi_ap_interface_receive_dropped_total{interface="eth0",name="ap"}`:  5,
+		`unifi_ap_interface_transmit_dropped_total{interface="eth0",name="ap"}`: 6,
+		`unifi_ap_interface_speed_bps{interface="br0",name="ap"}`:               0,
+		// Ports missing from the interface table are added by interface name
+		`unifi_ap_interface_speed_bps{interface="eth1",name="ap"}`:            10e6,
+		`unifi_ap_interface_up{interface="eth1",name="ap"}`:                   0,
+		`unifi_ap_interface_receive_errors_total{interface="eth1",name="ap"}`: 7,
+		`unifi_ap_interface_up{interface="Main",name="ap"}`:                   math.NaN(),
+		// Device totals only count interfaces that are up, and only once
+		`unifi_ap_receive_bytes_total{model="",name="ap"}`:  1100,
+		`unifi_ap_transmit_bytes_total{model="",name="ap"}`: 2200,
+	})
+}
+
+func TestUplinkSwitch(t *testing.T) {
+	uplink := &APUplink{Name: "eth0", UplinkMac: "02:00:00:00:02:00", UplinkDeviceName: "core-switch", UplinkRemotePort: 5}
+	tests := []struct {
+		name       string
+		info       AccessPointInfo
+		switchName string
+		port       string
+		chassisID  string
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name:       "uplink only",
+			info:       AccessPointInfo{Uplink: uplink},
+			switchName: "core-switch", port: "5", chassisID: "02:00:00:00:02:00",
+		},
+		{
+			name: "LLDP on the uplink port",
+			info: AccessPointInfo{Uplink: uplink, LLDPTable: []APNeighbor{
+				{ChassisID: "02:00:00:00:03:00", PortID: "Gi1/0/5", SystemName: "lldp-switch", LocalPortName: "eth0", IsWired: true},
+			}},
+			switchName: "lldp-switch", port: "Gi1/0/5", chassisID: "02:00:00:00:03:00",
+		},
+		{
+			name: "LLDP without a system name",
+			info: AccessPointInfo{Uplink: uplink, LLDPTable: []APNeighbor{
+				{ChassisID: "02:00:00:00:03:00", PortID: "Gi1/0/5", LocalPortName: "eth0", IsWired: true},
+			}},
+			switchName: "core-switch", port: "Gi1/0/5", chassisID: "02:00:00:00:03:00",
+		},
+		{
+			name: "LLDP on another port or wireless",
+			info: AccessPointInfo{Uplink: uplink, LLDPTable: []APNeighbor{
+				{ChassisID: "02:00:00:00:04:00", PortID: "1", SystemName: "other", LocalPortName: "eth1", IsWired: true},
+				{ChassisID: "02:00:00:00:05:00", PortID: "2", SystemName: "mesh", LocalPortName: "eth0"},
+			}},
+			switchName: "core-switch", port: "5", chassisID: "02:00:00:00:02:00",
+		},
+		{
+			name: "LLDP without uplink",
+			info: AccessPointInfo{LLDPTable: []APNeighbor{
+				{ChassisID: "02:00:00:00:03:00", PortID: "Port 5", SystemName: "lldp-switch", LocalPortName: "eth0", IsWired: true},
+			}},
+			switchName: "lldp-switch", port: "Port 5", chassisID: "02:00:00:00:03:00",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			switchName, port, chassisID := test.info.UplinkSwitch()
+			if switchName != test.switchName || port != test.port || chassisID != test.chassisID {
+				t.Errorf("got %q, %q, %q, want %q, %q, %q",
+					switchName, port, chassisID, test.switchName, test.port, test.chassisID)
+			}
+		})
+	}
+}
+
+func TestUplinkMetrics(t *testing.T) {
+	metrics := scrapeFixture(t, `{
+		"uplink": {"name": "eth0", "speed": "100", "full_duplex": false, "up": true,
+			"uplink_mac": "02:00:00:00:02:00", "uplink_device_name": "core-switch", "uplink_remote_port": 5},
+		"lldp_table": [{"chassis_id": "02:00:00:00:02:00", "port_id": "Port 5", "system_name": "core-switch",
+			"local_port_name": "eth0", "is_wired": true}]
+	}`)
+	checkMetrics(t, metrics, map[string]float64{
+		`unifi_ap_uplink_info{chassis_id="02:00:00:00:02:00",name="ap",port="Port 5",switch="core-switch"}`: 1,
+		`unifi_ap_uplink_speed_bps{interface="eth0",name="ap"}`:                                             100e6,
+		`unifi_ap_uplink_full_duplex{interface="eth0",name="ap"}`:                                           0,
+		`unifi_ap_uplink_up{interface="eth0",name="ap"}`:                                                    1,
+	})
+
+	// Without uplink data nothing is reported
+	metrics = scrapeFixture(t, `{}`)
+	for series := range metrics {
+		if strings.HasPrefix(series, "unifi_ap_uplink_") {
+			t.Errorf("unexpected %s", series)
+		}
+	}
+}
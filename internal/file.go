@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const SourceFile = "file"
+
+// Replays saved mca-dump output, cycling through the files matching the path
+// on every fetch
+type fileSource struct {
+	mutex sync.Mutex
+	next  map[string]int
+}
+
+func (s *fileSource) Fetch(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error) {
+	paths, err := filepath.Glob(accessPoint.Path)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonCommand, Err: err}
+	}
+	if len(paths) == 0 {
+		return nil, &FetchError{Reason: ReasonCommand, Err: errors.New("no files match " + accessPoint.Path)}
+	}
+	sort.Strings(paths)
+
+	s.mutex.Lock()
+	path := paths[s.next[accessPoint.Name]%len(paths)]
+	s.next[accessPoint.Name]++
+	s.mutex.Unlock()
+
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonCommand, Err: err}
+	}
+	return decode(accessPoint, output)
+}
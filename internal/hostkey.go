@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type HostKeyMismatchError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: got %s", e.Host, e.Fingerprint)
+}
+
+type UnknownHostKeyError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("unknown host key for %s: %s", e.Host, e.Fingerprint)
+}
+
+type hostKeyStore struct {
+	mutex sync.Mutex
+}
+
+func (c *Collector) hostKeyCallback(pinned string) ssh.HostKeyCallback {
+	// A pinned fingerprint takes precedence over known_hosts
+	if pinned != "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if strings.TrimPrefix(fingerprint, "SHA256:") != strings.TrimPrefix(pinned, "SHA256:") {
+				return &HostKeyMismatchError{Host: hostname, Fingerprint: fingerprint}
+			}
+			return nil
+		}
+	}
+
+	global := c.Config().Global
+	if global.KnownHosts == "" {
+		return ssh.InsecureIgnoreHostKey()
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return c.hostKeys.check(global.KnownHosts, global.TrustOnFirstUse, hostname, remote, key)
+	}
+}
+
+func (s *hostKeyStore) check(path string, trustOnFirstUse bool, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Read the file on every check so that keys added by other access points are seen
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && trustOnFirstUse {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			return err
+		}
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return err
+	}
+
+	err = callback(hostname, remote, key)
+	var keyError *knownhosts.KeyError
+	if !errors.As(err, &keyError) {
+		return err
+	}
+	if len(keyError.Want) > 0 {
+		return &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+	}
+	if !trustOnFirstUse {
+		return &UnknownHostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := fmt.Fprintln(file, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+		return err
+	}
+	log.Infof("%s: trusting new host key %s", hostname, ssh.FingerprintSHA256(key))
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Connect to the address, through a comma separated chain of jump hosts if any
+func (c *Collector) dialContext(ctx context.Context, proxyJump string, address string) (net.Conn, error) {
+	if proxyJump == "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, &FetchError{Reason: ReasonDial, Err: err}
+		}
+		return conn, nil
+	}
+
+	// Jump host connections are shared, so only one per chain is dialed at a time
+	unlock := c.jumpLocks.lock(proxyJump)
+	client, err := c.jumpClient(ctx, proxyJump)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dialThrough(ctx, proxyJump, client, address)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonDial, Err: err}
+	}
+	return conn, nil
+}
+
+// Connect to the address through the jump host connection of the chain. The
+// connection is shared, so it is only discarded when it is broken, not when
+// the jump host merely cannot reach the address.
+func (c *Collector) dialThrough(ctx context.Context, chain string, client *ssh.Client, address string) (net.Conn, error) {
+	conn, err := client.DialContext(ctx, "tcp", address)
+	var openChannelError *ssh.OpenChannelError
+	if err != nil && ctx.Err() == nil && !errors.As(err, &openChannelError) {
+		c.jumps.discard(chain, client)
+	}
+	return conn, err
+}
+
+// Must be called with the lock of the chain held
+func (c *Collector) jumpClient(ctx context.Context, chain string) (*ssh.Client, error) {
+	if client := c.jumps.get(chain); client != nil {
+		return client, nil
+	}
+
+	config := c.Config()
+	previous, name := "", chain
+	if i := strings.LastIndex(chain, ","); i >= 0 {
+		previous, name = chain[:i], chain[i+1:]
+	}
+	jumpHost, ok := config.JumpHosts[name]
+	if !ok {
+		return nil, &FetchError{Reason: ReasonDial, Err: fmt.Errorf("unknown jump host `%s`", name)}
+	}
+
+	var method string
+	clientConfig, done, err := c.clientConfig(jumpHost.Address, jumpHost.AuthConfig, jumpHost.Fingerprint, &method)
+	if err != nil {
+		return nil, jumpHostError(name, err)
+	}
+	defer done()
+	address := joinHostPort(jumpHost.Address, jumpHost.Port)
+	var conn net.Conn
+	if previous == "" {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		// A chain only ever waits for its own prefix, so locks cannot deadlock
+		var client *ssh.Client
+		unlock := c.jumpLocks.lock(previous)
+		client, err = c.jumpClient(ctx, previous)
+		unlock()
+		if err != nil {
+			return nil, err
+		}
+		conn, err = c.dialThrough(ctx, previous, client, address)
+	}
+	if err != nil {
+		return nil, jumpHostError(name, err)
+	}
+	client, err := handshake(ctx, conn, address, clientConfig)
+	if err != nil {
+		return nil, jumpHostError(name, err)
+	}
+
+	log.Debugf("%s: authenticated using %s", name, method)
+	c.jumps.put(chain, name, client, config.Global.Keepalive)
+	return client, nil
+}
+
+// Any failure to reach the access point through a jump host is a dial error
+func jumpHostError(name string, err error) error {
+	return &FetchError{Reason: ReasonDial, Err: fmt.Errorf("jump host `%s`: %w", name, err)}
+}
+
+// A mutex per key, so that work on one key does not wait for another
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (k *keyedMutex) lock(key string) func() {
+	k.mutex.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestJumpHostKeptWhenTargetRefused(t *testing.T) {
+	// The simulator refuses to forward connections, like a bastion that cannot
+	// reach the access point
+	address, port, fingerprint := startSimulator(t, SimulatorConfig{})
+	config := mustLoadConfig(t, fmt.Sprintf(`
+global:
+  timeout: 1s
+jump_hosts:
+  bastion:
+    address: %s
+    port: %d
+    username: admin
+    password: secret
+    fingerprint: %s
+accesspoints:
+  - name: ap
+    address: 192.0.2.10
+    username: admin
+    password: secret
+    proxy_jump: bastion
+`, address, port, fingerprint))
+	collector := NewCollector(*config)
+
+	_, err := collector.dialContext(context.Background(), "bastion", "192.0.2.10:22")
+	var fetchError *FetchError
+	if !errors.As(err, &fetchError) || fetchError.Reason != ReasonDial {
+		t.Fatalf("got error %v, want a dial error", err)
+	}
+	client := collector.jumps.get("bastion")
+	if client == nil {
+		t.Fatal("jump host connection was discarded")
+	}
+
+	if _, err := collector.dialContext(context.Background(), "bastion", "192.0.2.11:22"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if collector.jumps.get("bastion") != client {
+		t.Error("jump host connection was not reused")
+	}
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (c *Collector) Polling() bool {
+	return c.Config().Global.PollInterval > 0
+}
+
+// Poll all access points in the background, if enabled, until the context is
+// cancelled. Polling restarts whenever the configuration changes.
+func (c *Collector) Poll(ctx context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pollContext = ctx
+	c.restartPolling()
+}
+
+// Must be called with the mutex held
+func (c *Collector) restartPolling() {
+	if c.pollCancel != nil {
+		c.pollCancel()
+		c.pollCancel = nil
+	}
+	if c.pollContext == nil || !c.Polling() {
+		return
+	}
+
+	log.Info("polling access points every ", c.Config().Global.PollInterval)
+	ctx, cancel := context.WithCancel(c.pollContext)
+	c.pollCancel = cancel
+	for _, accessPoint := range c.Config().AccessPoints {
+		go c.poll(ctx, accessPoint)
+	}
+}
+
+func (c *Collector) poll(ctx context.Context, accessPoint AccessPointConfig) {
+	interval := c.pollInterval(accessPoint)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, min(interval, c.Config().Global.Timeout))
+		accessPointInfo := c.fetch(fetchCtx, accessPoint)
+		cancel()
+
+		// Polling may have been restarted with a new configuration meanwhile
+		c.mutex.Lock()
+		if ctx.Err() != nil {
+			c.mutex.Unlock()
+			return
+		}
+		c.cache[accessPoint.Name] = accessPointInfo
+		c.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) pollInterval(accessPoint AccessPointConfig) time.Duration {
+	if accessPoint.PollInterval > 0 {
+		return accessPoint.PollInterval
+	}
+	return c.Config().Global.PollInterval
+}
+
+func (c *Collector) maxAge(accessPoint AccessPointConfig) time.Duration {
+	if maxAge := c.Config().Global.MaxAge; maxAge > 0 {
+		return maxAge
+	}
+	return 3 * c.pollInterval(accessPoint)
+}
+
+// Return the cached results in configuration order, without expired entries
+func (c *Collector) Cached() *[]AccessPointInfo {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var accessPointInfos = []AccessPointInfo{}
+	for _, accessPoint := range c.Config().AccessPoints {
+		accessPointInfo, ok := c.cache[accessPoint.Name]
+		if !ok {
+			continue
+		}
+		if time.Since(accessPointInfo.Timestamp) > c.maxAge(accessPoint) {
+			delete(c.cache, accessPoint.Name)
+			continue
+		}
+		accessPointInfos = append(accessPointInfos, accessPointInfo)
+	}
+
+	return &accessPointInfos
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Persistent SSH connections, one per access point configuration or jump host
+// chain
+type connectionPool[K comparable] struct {
+	mutex   sync.Mutex
+	clients map[K]*ssh.Client
+}
+
+func (p *connectionPool[K]) get(key K) *ssh.Client {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.clients[key]
+}
+
+// Add the connection, unless a concurrent fetch already pooled one
+func (p *connectionPool[K]) put(key K, name string, client *ssh.Client, keepalive time.Duration) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.clients[key]; ok {
+		return false
+	}
+	p.clients[key] = client
+	go p.keepalive(key, name, client, keepalive)
+	return true
+}
+
+// Close the connection, and forget it if it is still the pooled one
+func (p *connectionPool[K]) discard(key K, client *ssh.Client) {
+	p.mutex.Lock()
+	if p.clients[key] == client {
+		delete(p.clients, key)
+	}
+	p.mutex.Unlock()
+
+	_ = client.Close()
+}
+
+func (p *connectionPool[K]) keepalive(key K, name string, client *ssh.Client, interval time.Duration) {
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			p.discard(key, client)
+			return
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				log.Debugf("%s: keepalive failed: %s", name, err)
+				p.discard(key, client)
+				return
+			}
+		}
+	}
+}
+
+// Close all connections that are not to be kept
+func (p *connectionPool[K]) prune(keep func(K) bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key, client := range p.clients {
+		if !keep(key) {
+			delete(p.clients, key)
+			_ = client.Close()
+		}
+	}
+}
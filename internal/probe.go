@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collects a single access point that is not part of the configuration
+type probe struct {
+	exporter    *Exporter
+	ctx         context.Context
+	accessPoint AccessPointConfig
+}
+
+func (p *probe) Describe(ch chan<- *prometheus.Desc) {
+	p.exporter.Describe(ch)
+}
+
+func (p *probe) Collect(ch chan<- prometheus.Metric) {
+	accessPointInfo, status := p.exporter.collector.probe(p.ctx, p.accessPoint)
+	p.exporter.collectStatus(ch, status)
+	p.exporter.collectAccessPoint(ch, accessPointInfo)
+}
+
+func (e *Exporter) handleProbe(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "missing `target` parameter", http.StatusBadRequest)
+		return
+	}
+	accessPoint, err := e.collector.Config().probeAccessPoint(target, r.URL.Query().Get("auth"))
+	if errors.Is(err, errUnverifiedProbe) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), e.scrapeTimeout(r))
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&probe{
+		exporter:    e,
+		ctx:         ctx,
+		accessPoint: accessPoint,
+	})
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
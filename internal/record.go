@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Where access points with `record` are recorded without a `record_dir`
+var defaultRecordDir = filepath.Join(os.TempDir(), "unifi-ap-exporter")
+
+// Keep the raw output of a configured access point in memory if the dump
+// endpoint is enabled, and write it to the record directory if recorded
+func (c *Collector) saveDump(accessPoint AccessPointConfig, accessPointInfo AccessPointInfo) {
+	if accessPointInfo.Raw == nil {
+		return
+	}
+	config := c.Config()
+	configured := slices.ContainsFunc(config.AccessPoints, func(configured AccessPointConfig) bool {
+		return configured.Name == accessPoint.Name
+	})
+	if config.Global.DumpEndpoint && configured {
+		c.mutex.Lock()
+		c.dumps[accessPoint.Name] = accessPointInfo.Raw
+		c.mutex.Unlock()
+	}
+	recordDir := config.Global.RecordDir
+	if recordDir == "" {
+		if !accessPoint.Record {
+			return
+		}
+		recordDir = defaultRecordDir
+	}
+	if err := writeDump(recordDir, config.Global.RecordLimit, accessPointInfo); err != nil {
+		log.Warnf("%s: cannot record output: %s", accessPoint.Name, err)
+	}
+}
+
+// Tell where access points are recorded without a `record_dir`
+func logRecording(config Config) {
+	if config.Global.RecordDir != "" {
+		return
+	}
+	for _, accessPoint := range config.AccessPoints {
+		if accessPoint.Record {
+			log.Infof("recording access points with `record` in %s, set `record_dir` to change", defaultRecordDir)
+			return
+		}
+	}
+}
+
+func (c *Collector) Dump(name string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	dump, ok := c.dumps[name]
+	return dump, ok
+}
+
+// Write the output to a timestamped file in a directory per access point,
+// removing the oldest files beyond the limit
+func writeDump(recordDir string, limit int, accessPointInfo AccessPointInfo) error {
+	dir := filepath.Join(recordDir, safeFileName(accessPointInfo.Name))
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	name := accessPointInfo.Timestamp.UTC().Format("20060102T150405.000Z") + ".json"
+	if err := os.WriteFile(filepath.Join(dir, name), accessPointInfo.Raw, 0640); err != nil {
+		return err
+	}
+
+	// Timestamps sort in order of time, and ReadDir sorts by name
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+	for len(files) > limit {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Replace anything that is not safe in a file name, including names of only
+// dots, which would refer to the directory itself or its parent
+func safeFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(safe, ".") == "" {
+		safe = strings.Repeat("_", len(safe))
+	}
+	return safe
+}
+
+func (e *Exporter) handleDump(w http.ResponseWriter, r *http.Request) {
+	if !e.collector.Config().Global.DumpEndpoint {
+		http.Error(w, "dump endpoint is not enabled", http.StatusForbidden)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing `name` parameter", http.StatusBadRequest)
+		return
+	}
+	dump, ok := e.collector.Dump(name)
+	if !ok {
+		http.Error(w, "no output of access point "+name, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(dump)
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		safe string
+	}{
+		{"ap-1.example", "ap-1.example"},
+		{"../ap", ".._ap"},
+		{"a/b c", "a_b_c"},
+		{".", "_"},
+		{"..", "__"},
+		{"...", "___"},
+	}
+	for _, test := range tests {
+		if safe := safeFileName(test.name); safe != test.safe {
+			t.Errorf("%q: got %q, want %q", test.name, safe, test.safe)
+		}
+	}
+}
+
+func TestWriteDump(t *testing.T) {
+	recordDir := t.TempDir()
+	// Files outside the directory of the access point are never pruned
+	outside := filepath.Join(recordDir, "other.json")
+	if err := os.WriteFile(outside, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 5 {
+		accessPointInfo := AccessPointInfo{
+			Name:      "..",
+			Raw:       []byte(fmt.Sprint(i)),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		}
+		if err := writeDump(recordDir, 3, accessPointInfo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(recordDir, "__"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"20260102T030407.000Z.json", "20260102T030408.000Z.json", "20260102T030409.000Z.json"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("got files %v, want %v", names, want)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the access point directory was removed: %s", err)
+	}
+}
+
+func TestSaveDump(t *testing.T) {
+	defaultDir := t.TempDir()
+	defer func(dir string) {
+		defaultRecordDir = dir
+	}(defaultRecordDir)
+	defaultRecordDir = defaultDir
+	recordDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		global   string
+		dir      string
+		recorded []string
+	}{
+		{
+			name:     "record dir records every access point",
+			global:   "  record_dir: " + recordDir + "\n",
+			dir:      recordDir,
+			recorded: []string{"opted-in", "other"},
+		},
+		{
+			name:     "record opts in without a record dir",
+			dir:      defaultDir,
+			recorded: []string{"opted-in"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := mustLoadConfig(t, "global:\n  dump_endpoint: true\n"+test.global+`
+defaults:
+  username: admin
+  password: secret
+accesspoints:
+  - name: opted-in
+    address: 192.0.2.10
+    record: true
+  - name: other
+    address: 192.0.2.11
+`)
+			collector := NewCollector(*config)
+			for _, accessPoint := range config.AccessPoints {
+				collector.saveDump(accessPoint, AccessPointInfo{
+					Name:      accessPoint.Name,
+					Raw:       []byte(`{}`),
+					Timestamp: time.Now(),
+				})
+			}
+
+			entries, err := os.ReadDir(test.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recorded []string
+			for _, entry := range entries {
+				recorded = append(recorded, entry.Name())
+			}
+			// ReadDir sorts by name
+			if fmt.Sprint(recorded) != fmt.Sprint(test.recorded) {
+				t.Errorf("recorded %v, want %v", recorded, test.recorded)
+			}
+			if _, ok := collector.Dump("other"); !ok {
+				t.Error("output is not kept for the dump endpoint")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type reloadStatus struct {
+	mutex      sync.Mutex
+	successful bool
+	timestamp  time.Time
+}
+
+func (r *reloadStatus) set(successful bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.successful = successful
+	if successful {
+		r.timestamp = time.Now()
+	}
+}
+
+func (r *reloadStatus) get() (float64, time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.successful {
+		return 1, r.timestamp
+	}
+	return 0, r.timestamp
+}
+
+// Re-read the configuration file, keeping the current configuration if the new
+// one is invalid
+func (c *Collector) Reload() error {
+	config, err := NewConfig(c.Config().path)
+	if err != nil {
+		return err
+	}
+	c.SetConfig(*config)
+	return nil
+}
+
+func (c *Collector) SetConfig(config Config) {
+	previous := c.Config()
+	if !slices.Equal(config.Global.ListenAddresses, previous.Global.ListenAddresses) {
+		log.Warn("changing `port` or `listen_address` requires a restart")
+	}
+	warnInsecure(config)
+	logRecording(config)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.config.Store(&config)
+	if config.Global.Concurrency != previous.Global.Concurrency {
+		c.semaphore = make(chan struct{}, config.Global.Concurrency)
+	}
+	names := map[string]bool{}
+	for _, accessPoint := range config.AccessPoints {
+		names[accessPoint.Name] = true
+	}
+	for name := range c.cache {
+		if !names[name] {
+			delete(c.cache, name)
+		}
+	}
+	for name := range c.dumps {
+		if !names[name] || !config.Global.DumpEndpoint {
+			delete(c.dumps, name)
+		}
+	}
+	keep := map[AccessPointConfig]bool{}
+	for _, accessPoint := range config.AccessPoints {
+		keep[accessPoint] = true
+	}
+	c.pool.prune(func(accessPoint AccessPointConfig) bool {
+		return keep[accessPoint]
+	})
+	if !maps.Equal(config.JumpHosts, previous.JumpHosts) || config.Global.KnownHosts != previous.Global.KnownHosts {
+		c.jumps.prune(func(string) bool {
+			return false
+		})
+	}
+	c.restartPolling()
+}
+
+func (e *Exporter) Reload() error {
+	if err := e.collector.Reload(); err != nil {
+		e.reloads.set(false)
+		log.Errorf("cannot reload config file: %s", err)
+		return err
+	}
+	e.reloads.set(true)
+	log.Info("reloaded config file")
+	return nil
+}
+
+func (e *Exporter) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			_ = e.Reload()
+		}
+	}()
+}
+
+func (e *Exporter) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !e.collector.Config().Global.ReloadEndpoint {
+		http.Error(w, "reload endpoint is not enabled", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
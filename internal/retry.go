@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retry failed fetches with jittered exponential backoff, as long as the
+// context allows
+func (c *Collector) fetchWithRetries(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error) {
+	global := c.Config().Global
+	for retry := 0; ; retry++ {
+		accessPointInfo, err := c.attempt(ctx, accessPoint)
+		if err == nil || retry >= global.Retries || !retryable(err) || ctx.Err() != nil {
+			return accessPointInfo, err
+		}
+
+		delay := backoff(global.RetryBackoff, retry)
+		log.Debugf("%s: retrying in %s: %s", accessPoint.Name, delay.Round(time.Millisecond), err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// A host key mismatch will not go away by trying again
+func retryable(err error) bool {
+	var fetchError *FetchError
+	return !errors.As(err, &fetchError) || fetchError.Reason != ReasonHostKey
+}
+
+// Double the delay on every retry, randomized by ±50%
+func backoff(base time.Duration, retry int) time.Duration {
+	delay := base << retry
+	return delay/2 + rand.N(delay)
+}
+
+func (c *Collector) circuitOpen(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status, ok := c.status[name]
+	return ok && time.Now().Before(status.CircuitOpenUntil)
+}
+
+// Must be called with the mutex held
+func (c *Collector) updateCircuit(status *AccessPointStatus, err error) {
+	if err == nil {
+		status.ConsecutiveFailures = 0
+		return
+	}
+	status.ConsecutiveFailures++
+
+	global := c.Config().Global
+	if global.CircuitBreakerThreshold > 0 && status.ConsecutiveFailures >= global.CircuitBreakerThreshold {
+		// After the cool-down a single failure opens the circuit again
+		status.CircuitOpenUntil = time.Now().Add(global.CircuitBreakerCooldown)
+		log.Warnf("%s: %d consecutive failures, skipping for %s", status.Name, status.ConsecutiveFailures, global.CircuitBreakerCooldown)
+	}
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const secretCommandTimeout = 10 * time.Second
+
+var environmentVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Expand ${VAR} in all scalar values. Unquoted values are re-resolved after
+// expansion, so that `port: ${PORT}` still decodes as a number.
+func expandEnvironment(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && environmentVariable.MatchString(node.Value) {
+		var err error
+		node.Value = environmentVariable.ReplaceAllStringFunc(node.Value, func(match string) string {
+			name := environmentVariable.FindStringSubmatch(match)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("line %d: environment variable `%s` is not set", node.Line, name)
+			}
+			return value
+		})
+		if err != nil {
+			return err
+		}
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+	for _, child := range node.Content {
+		if err := expandEnvironment(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fill in the password and key file passphrase from whichever source is
+// configured
+func (a *AuthConfig) resolve() error {
+	sources := 0
+	for _, source := range []string{a.Password, a.PasswordFile, a.PasswordEnv, a.PasswordCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("accepts only one of `password`, `password_file`, `password_env` and `password_command`")
+	}
+
+	password, err := readSecret(a.PasswordFile, a.PasswordEnv, a.PasswordCommand)
+	if err != nil {
+		return fmt.Errorf("cannot read password: %w", err)
+	}
+	if password != "" {
+		a.Password = password
+	}
+	a.PasswordFile, a.PasswordEnv, a.PasswordCommand = "", "", ""
+
+	if a.KeyFilePassphrase != "" && (a.KeyFilePassphraseFile != "" || a.KeyFilePassphraseEnv != "") ||
+		a.KeyFilePassphraseFile != "" && a.KeyFilePassphraseEnv != "" {
+		return errors.New("accepts only one of `keyfile_passphrase`, `keyfile_passphrase_file` and `keyfile_passphrase_env`")
+	}
+	passphrase, err := readSecret(a.KeyFilePassphraseFile, a.KeyFilePassphraseEnv, "")
+	if err != nil {
+		return fmt.Errorf("cannot read key file passphrase: %w", err)
+	}
+	if passphrase != "" {
+		a.KeyFilePassphrase = passphrase
+	}
+	a.KeyFilePassphraseFile, a.KeyFilePassphraseEnv = "", ""
+	return nil
+}
+
+func readSecret(file string, env string, command string) (string, error) {
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case env != "":
+		value := os.Getenv(env)
+		if value == "" {
+			return "", fmt.Errorf("environment variable `%s` is empty", env)
+		}
+		return value, nil
+	case command != "":
+		// No shell is involved, arguments are split on whitespace
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return "", errors.New("command is empty")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+		defer cancel()
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("`%s`: %w", args[0], err)
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UNIFI_AP_TEST_SECRET", "from-env")
+	t.Setenv("UNIFI_AP_TEST_EMPTY", "")
+
+	tests := []struct {
+		name       string
+		auth       AuthConfig
+		password   string
+		passphrase string
+		err        string
+	}{
+		{
+			name:     "password",
+			auth:     AuthConfig{Password: "plain"},
+			password: "plain",
+		},
+		{
+			name:     "password file",
+			auth:     AuthConfig{PasswordFile: secretFile},
+			password: "from-file",
+		},
+		{
+			name:     "password env",
+			auth:     AuthConfig{PasswordEnv: "UNIFI_AP_TEST_SECRET"},
+			password: "from-env",
+		},
+		{
+			name:     "password command",
+			auth:     AuthConfig{PasswordCommand: "echo from-command"},
+			password: "from-command",
+		},
+		{
+			name: "password and password file",
+			auth: AuthConfig{Password: "plain", PasswordFile: secretFile},
+			err:  "accepts only one of",
+		},
+		{
+			name: "password env and password command",
+			auth: AuthConfig{PasswordEnv: "UNIFI_AP_TEST_SECRET", PasswordCommand: "echo from-command"},
+			err:  "accepts only one of",
+		},
+		{
+			name: "missing password file",
+			auth: AuthConfig{PasswordFile: filepath.Join(t.TempDir(), "missing")},
+			err:  "cannot read password",
+		},
+		{
+			name: "empty password env",
+			auth: AuthConfig{PasswordEnv: "UNIFI_AP_TEST_EMPTY"},
+			err:  "environment variable `UNIFI_AP_TEST_EMPTY` is empty",
+		},
+		{
+			name: "whitespace password command",
+			auth: AuthConfig{PasswordCommand: " \t "},
+			err:  "command is empty",
+		},
+		{
+			name: "failing password command",
+			auth: AuthConfig{PasswordCommand: "false"},
+			err:  "`false`",
+		},
+		{
+			name:       "passphrase file",
+			auth:       AuthConfig{KeyFile: "key", KeyFilePassphraseFile: secretFile},
+			passphrase: "from-file",
+		},
+		{
+			name:       "passphrase env",
+			auth:       AuthConfig{KeyFile: "key", KeyFilePassphraseEnv: "UNIFI_AP_TEST_SECRET"},
+			passphrase: "from-env",
+		},
+		{
+			name: "passphrase and passphrase env",
+			auth: AuthConfig{KeyFile: "key", KeyFilePassphrase: "plain", KeyFilePassphraseEnv: "UNIFI_AP_TEST_SECRET"},
+			err:  "accepts only one of `keyfile_passphrase`",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := test.auth
+			err := auth.resolve()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.Password != test.password || auth.KeyFilePassphrase != test.passphrase {
+				t.Errorf("got password %q and passphrase %q, want %q and %q",
+					auth.Password, auth.KeyFilePassphrase, test.password, test.passphrase)
+			}
+			if auth.PasswordFile != "" || auth.PasswordEnv != "" || auth.PasswordCommand != "" ||
+				auth.KeyFilePassphraseFile != "" || auth.KeyFilePassphraseEnv != "" {
+				t.Errorf("secret sources are not cleared: %+v", auth)
+			}
+		})
+	}
+}
+
+func TestExpandEnvironment(t *testing.T) {
+	t.Setenv("UNIFI_AP_TEST_PORT", "2222")
+	t.Setenv("UNIFI_AP_TEST_USER", "admin")
+
+	config := mustLoadConfig(t, `
+defaults:
+  username: ${UNIFI_AP_TEST_USER}
+  password: secret
+accesspoints:
+  - name: ap
+    address: 192.0.2.10
+    port: ${UNIFI_AP_TEST_PORT}
+`)
+	if accessPoint := config.AccessPoints[0]; accessPoint.Port != 2222 || accessPoint.Username != "admin" {
+		t.Errorf("unexpected access point %+v", accessPoint)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("defaults:\n  username: ${UNIFI_AP_TEST_UNSET}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConfig(path); err == nil || !strings.Contains(err.Error(), "`UNIFI_AP_TEST_UNSET` is not set") {
+		t.Errorf("got error %v for an unset variable", err)
+	}
+}
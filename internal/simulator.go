@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// The output of mca-dump of a simulated access point, unless another fixture
+// is given
+//
+//go:embed simulator.json
+var DefaultFixture []byte
+
+type SimulatorConfig struct {
+	ListenAddress string
+	Username      string
+	Password      string
+	Fixture       []byte
+	Delay         time.Duration
+	FailAuth      bool
+	Malformed     bool
+}
+
+// An SSH server that answers mca-dump like an access point does
+type Simulator struct {
+	config  SimulatorConfig
+	server  *ssh.ServerConfig
+	hostKey ssh.Signer
+}
+
+func NewSimulator(config SimulatorConfig) (*Simulator, error) {
+	if config.Fixture == nil {
+		config.Fixture = DefaultFixture
+	}
+
+	// A new host key on every start, pin it with the logged fingerprint
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	simulator := &Simulator{
+		config:  config,
+		hostKey: hostKey,
+	}
+	simulator.server = &ssh.ServerConfig{
+		PasswordCallback: simulator.authenticate,
+	}
+	simulator.server.AddHostKey(hostKey)
+	return simulator, nil
+}
+
+func (s *Simulator) Fingerprint() string {
+	return ssh.FingerprintSHA256(s.hostKey.PublicKey())
+}
+
+func (s *Simulator) authenticate(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if s.config.FailAuth || conn.User() != s.config.Username || string(password) != s.config.Password {
+		return nil, errors.New("permission denied")
+	}
+	return nil, nil
+}
+
+func (s *Simulator) Run() error {
+	listener, err := net.Listen("tcp", s.config.ListenAddress)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Accept connections until the listener is closed
+func (s *Simulator) Serve(listener net.Listener) error {
+	log.Infof("simulating access point on %s with host key %s", listener.Addr(), s.Fingerprint())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Simulator) handle(conn net.Conn) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.server)
+	if err != nil {
+		log.Debugf("%s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer func() {
+		_ = sshConn.Close()
+	}()
+	log.Debugf("%s: logged in as %s", conn.RemoteAddr(), sshConn.User())
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Debugf("%s: %s", conn.RemoteAddr(), err)
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+// Serve a single exec request, refusing shells and everything else
+func (s *Simulator) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() {
+		_ = channel.Close()
+	}()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			_ = request.Reply(false, nil)
+			continue
+		}
+		var exec struct {
+			Command string
+		}
+		if err := ssh.Unmarshal(request.Payload, &exec); err != nil {
+			_ = request.Reply(false, nil)
+			continue
+		}
+		_ = request.Reply(true, nil)
+
+		status := struct {
+			Status uint32
+		}{}
+		if exec.Command == "mca-dump" {
+			time.Sleep(s.config.Delay)
+			output := s.config.Fixture
+			if s.config.Malformed {
+				output = output[:len(output)/2]
+			}
+			_, _ = channel.Write(output)
+		} else {
+			_, _ = channel.Stderr().Write([]byte(exec.Command + ": not found\n"))
+			status.Status = 127
+		}
+		_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+		return
+	}
+}
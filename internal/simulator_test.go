@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a simulator on a random port, returning its address and fingerprint
+func startSimulator(t *testing.T, config SimulatorConfig) (string, int, string) {
+	t.Helper()
+	config.Username = "admin"
+	config.Password = "secret"
+	simulator, err := NewSimulator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		_ = simulator.Serve(listener)
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port, simulator.Fingerprint()
+}
+
+func TestSimulator(t *testing.T) {
+	simulators := []struct {
+		name   string
+		config SimulatorConfig
+	}{
+		{"good", SimulatorConfig{}},
+		{"auth", SimulatorConfig{FailAuth: true}},
+		{"delay", SimulatorConfig{Delay: 3 * time.Second}},
+		{"malformed", SimulatorConfig{Malformed: true}},
+	}
+
+	yaml := "global:\n  timeout: 1s\ndefaults:\n  username: admin\n  password: secret\naccesspoints:\n"
+	for _, simulator := range simulators {
+		address, port, fingerprint := startSimulator(t, simulator.config)
+		yaml += fmt.Sprintf("  - name: %s\n    address: %s\n    port: %d\n    fingerprint: %s\n",
+			simulator.name, address, port, fingerprint)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := NewConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(NewCollector(*config))
+
+	recorder := httptest.NewRecorder()
+	exporter.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := recorder.Body.String()
+
+	for _, metric := range []string{
+		`unifi_ap_up{name="good"} 1`,
+		`unifi_ap_scrape_errors_total{name="good",reason="auth"} 0`,
+		`unifi_ap_auth_info{method="password",name="good"} 1`,
+		`unifi_ap_info{ip="192.0.2.10",mac="74:83:c2:00:00:01",model="U7LT",model_name="UAP-AC-Lite",name="good",serial="7483C2000001",version="6.6.77.15402"} 1`,
+		`unifi_ap_uptime_seconds{model="U7LT",name="good"} 86400`,
+		`unifi_ap_radio_max_transmit_power{name="good",radio="na",radio_name="wifi1"} 23`,
+		`unifi_ap_interface_receive_errors_total{interface="eth0",name="good"} 3`,
+		`unifi_ap_vap_transmit_bytes_total{bssid="74:83:c2:00:00:03",essid="example",name="good",radio="na",radio_name="wifi1",usage="user",vap_name="ath2"} 3.3554432e+07`,
+		`unifi_ap_station_signal{mac="02:00:00:00:01:01",name="good"} -58`,
+		`unifi_ap_rogueap_signal{bssid="02:00:00:00:00:01",essid="neighbour",name="good",radio="ng",security="secured"} -72`,
+		`unifi_ap_up{name="auth"} 0`,
+		`unifi_ap_scrape_errors_total{name="auth",reason="auth"} 1`,
+		`unifi_ap_up{name="delay"} 0`,
+		`unifi_ap_scrape_errors_total{name="delay",reason="command"} 1`,
+		`unifi_ap_up{name="malformed"} 0`,
+		`unifi_ap_scrape_errors_total{name="malformed",reason="parse"} 1`,
+	} {
+		if !strings.Contains(metrics, metric+"\n") {
+			t.Errorf("missing %s", metric)
+		}
+	}
+	// Access points that are down only report their health
+	for _, line := range strings.Split(metrics, "\n") {
+		for _, name := range []string{"auth", "delay", "malformed"} {
+			if strings.HasPrefix(line, "unifi_ap_info{") && strings.Contains(line, `name="`+name+`"`) {
+				t.Errorf("down access point %s reports %s", name, line)
+			}
+		}
+	}
+	if t.Failed() {
+		t.Log(metrics)
+	}
+}
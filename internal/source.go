@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Source fetches the information of a single access point
+type Source interface {
+	Fetch(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error)
+}
+
+const SourceSSH = "ssh"
+
+// Sources by the name used as `source` of an access point, each created once
+// per collector
+var sources = map[string]func(c *Collector) Source{
+	SourceSSH: func(c *Collector) Source {
+		return &sshSource{collector: c}
+	},
+	SourceFile: func(c *Collector) Source {
+		return &fileSource{next: map[string]int{}}
+	},
+}
+
+// Make another source available to the configuration. Must be called before
+// the configuration is loaded.
+func RegisterSource(name string, newSource func(c *Collector) Source) {
+	sources[name] = newSource
+}
+
+func (c *Collector) Fetch(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error) {
+	source, ok := c.sources[accessPoint.Source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source `%s`", accessPoint.Source)
+	}
+	return source.Fetch(ctx, accessPoint)
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Runs mca-dump on the access point over SSH
+type sshSource struct {
+	collector *Collector
+}
+
+func (s *sshSource) Fetch(ctx context.Context, accessPoint AccessPointConfig) (*AccessPointInfo, error) {
+	c := s.collector
+	var method string
+	client, pooled, reused, err := c.connect(ctx, accessPoint, &method)
+	if err != nil {
+		return nil, err
+	}
+	output, err := c.run(ctx, accessPoint, client, pooled)
+	if err != nil && reused && ctx.Err() == nil {
+		// The pooled connection may have gone stale, retry once on a fresh one
+		log.Debugf("%s: pooled connection failed, reconnecting: %s", accessPoint.Address, err)
+		if client, pooled, _, err = c.connect(ctx, accessPoint, &method); err != nil {
+			return nil, err
+		}
+		output, err = c.run(ctx, accessPoint, client, pooled)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessPointInfo, err := decode(accessPoint, output)
+	if err != nil {
+		return nil, err
+	}
+	accessPointInfo.AuthMethod = method
+	return accessPointInfo, nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons a fetch can fail, used as label on the scrape errors metric
+const (
+	ReasonDial    = "dial"
+	ReasonAuth    = "auth"
+	ReasonHostKey = "hostkey"
+	ReasonCommand = "command"
+	ReasonParse   = "parse"
+)
+
+var Reasons = []string{ReasonDial, ReasonAuth, ReasonHostKey, ReasonCommand, ReasonParse}
+
+type FetchError struct {
+	Reason string
+	Err    error
+}
+
+func (e *FetchError) Error() string {
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+type AccessPointStatus struct {
+	Name                string
+	Errors              map[string]float64
+	DecodeWarnings      map[string]float64
+	LastSuccess         time.Time
+	AuthMethod          string
+	ConsecutiveFailures int
+	CircuitOpenUntil    time.Time
+}
+
+func newAccessPointStatus(name string) *AccessPointStatus {
+	return &AccessPointStatus{
+		Name:           name,
+		Errors:         map[string]float64{},
+		DecodeWarnings: map[string]float64{},
+	}
+}
+
+// Must be called with the mutex held
+func (c *Collector) accessPointStatus(name string) *AccessPointStatus {
+	status, ok := c.status[name]
+	if !ok {
+		status = newAccessPointStatus(name)
+		c.status[name] = status
+	}
+	return status
+}
+
+func (c *Collector) record(accessPointInfo AccessPointInfo, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := c.accessPointStatus(accessPointInfo.Name)
+	c.updateCircuit(status, err)
+	status.update(accessPointInfo, err)
+}
+
+// Count the outcome of a single fetch
+func (s *AccessPointStatus) update(accessPointInfo AccessPointInfo, err error) {
+	if accessPointInfo.AuthMethod != "" {
+		s.AuthMethod = accessPointInfo.AuthMethod
+	}
+	if err == nil {
+		s.LastSuccess = accessPointInfo.Timestamp
+		for _, field := range accessPointInfo.DecodeWarnings {
+			log.Debugf("%s: ignoring field %s of unexpected type", accessPointInfo.Name, field)
+			s.DecodeWarnings[field]++
+		}
+		return
+	}
+	reason := ReasonDial
+	var fetchError *FetchError
+	if errors.As(err, &fetchError) {
+		reason = fetchError.Reason
+	}
+	s.Errors[reason]++
+}
+
+// Return the status of all configured access points
+func (c *Collector) Status() []AccessPointStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var statuses = []AccessPointStatus{}
+	for _, accessPoint := range c.Config().AccessPoints {
+		status := newAccessPointStatus(accessPoint.Name)
+		if recorded, ok := c.status[accessPoint.Name]; ok {
+			status.LastSuccess = recorded.LastSuccess
+			status.AuthMethod = recorded.AuthMethod
+			status.ConsecutiveFailures = recorded.ConsecutiveFailures
+			status.CircuitOpenUntil = recorded.CircuitOpenUntil
+			for reason, count := range recorded.Errors {
+				status.Errors[reason] = count
+			}
+			for field, count := range recorded.DecodeWarnings {
+				status.DecodeWarnings[field] = count
+			}
+		}
+		statuses = append(statuses, *status)
+	}
+
+	return statuses
+}
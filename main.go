@@ -25,6 +25,11 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		simulate(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
 	if *jsonLogging {
@@ -55,6 +60,6 @@ func main() {
 	}
 
 	collector := unifiApExporter.NewCollector(*config)
-	exporter := unifiApExporter.NewExporter(*collector)
+	exporter := unifiApExporter.NewExporter(collector)
 	exporter.Run()
 }
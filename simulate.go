@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	unifiApExporter "unifi-ap-exporter/internal"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Run a fake access point for testing the exporter without hardware
+func simulate(arguments []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	listenAddress := flags.String("listen", "127.0.0.1:2222",
+		"Address to accept SSH connections on")
+	username := flags.String("username", "admin",
+		"Username to accept")
+	password := flags.String("password", "secret",
+		"Password to accept")
+	fixture := flags.String("fixture", "",
+		"File with the mca-dump output to return, instead of the built-in one")
+	delay := flags.Duration("delay", 0,
+		"Delay before answering mca-dump")
+	failAuth := flags.Bool("fail-auth", false,
+		"Reject all authentication")
+	malformed := flags.Bool("malformed", false,
+		"Return truncated mca-dump output")
+	verboseLogging := flags.Bool("verbose", false,
+		"Enable verbose logging")
+	_ = flags.Parse(arguments)
+
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+	if *verboseLogging {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	config := unifiApExporter.SimulatorConfig{
+		ListenAddress: *listenAddress,
+		Username:      *username,
+		Password:      *password,
+		Delay:         *delay,
+		FailAuth:      *failAuth,
+		Malformed:     *malformed,
+	}
+	if *fixture != "" {
+		var err error
+		if config.Fixture, err = os.ReadFile(*fixture); err != nil {
+			log.Errorf("cannot read fixture: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	simulator, err := unifiApExporter.NewSimulator(config)
+	if err != nil {
+		log.Errorf("cannot start simulator: %s", err)
+		os.Exit(1)
+	}
+	if err := simulator.Run(); err != nil {
+		log.Errorf("simulator failed: %s", err)
+		os.Exit(1)
+	}
+}